@@ -8,4 +8,6 @@ resource "aws_s3_bucket" "self" {
       }
     }
   }
+
+  tags = var.tags
 }
@@ -2,4 +2,5 @@ resource "aws_s3_bucket_object" "data" {
   bucket  = "weberc2-${var.workload.environment}-contracts"
   key     = "${var.workload.environment}/${var.workload.system}"
   content = jsonencode(var.data)
+  tags    = var.workload.tags
 }
\ No newline at end of file
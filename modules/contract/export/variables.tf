@@ -2,6 +2,7 @@ variable "workload" {
   type = object({
     environment = string
     system      = string
+    tags        = map(string)
   })
   description = "(Required) The workload module for the caller's system."
 }
@@ -15,7 +15,7 @@ output "contract_bucket" {
 }
 
 output "contract_key" {
-  value = var.system
+  value = "${var.environment}/${var.system}"
 }
 
 output "tags" {
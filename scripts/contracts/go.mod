@@ -0,0 +1,5 @@
+module github.com/weberc2/infra/scripts/contracts
+
+go 1.16
+
+require github.com/aws/aws-sdk-go v1.38.26
@@ -0,0 +1,223 @@
+// Command contracts inspects and edits the data which systems export through
+// the environment contracts buckets.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/weberc2/infra/scripts/contracts/pkg/contracts"
+)
+
+var dir = flag.String(
+	"dir",
+	"",
+	"read and write contracts in a local `directory` laid out like the "+
+		"contract buckets rather than in S3",
+)
+
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(store contracts.Store, args []string) error
+}
+
+var commands = []command{
+	{
+		name:    "get",
+		args:    "ENVIRONMENT/SYSTEM",
+		summary: "print a contract",
+		run:     get,
+	},
+	{
+		name:    "put",
+		args:    "ENVIRONMENT/SYSTEM [FILE]",
+		summary: "replace a contract with a JSON object (default: from stdin)",
+		run:     put,
+	},
+	{
+		name:    "list",
+		args:    "ENVIRONMENT",
+		summary: "list the systems which export contracts and their fields",
+		run:     list,
+	},
+	{
+		name:    "diff",
+		args:    "ENVIRONMENT/SYSTEM ENVIRONMENT/SYSTEM",
+		summary: "print the fields which differ between two contracts",
+		run:     diff,
+	},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: contracts [FLAGS] COMMAND [ARGS]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-45s %s\n", c.name+" "+c.args, c.summary)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var store contracts.Store
+	if *dir != "" {
+		store = &contracts.DirStore{Dir: *dir}
+	} else {
+		store = &contracts.S3Store{S3: s3.New(session.Must(session.NewSession()))}
+	}
+
+	for _, c := range commands {
+		if c.name == flag.Arg(0) {
+			if err := c.run(store, flag.Args()[1:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command '%s'\n", flag.Arg(0))
+	usage()
+	os.Exit(2)
+}
+
+// parseIDs parses exactly `n` contract IDs from the arguments.
+func parseIDs(args []string, n int) ([]contracts.ID, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("expected %d contract(s); got %d", n, len(args))
+	}
+	ids := make([]contracts.ID, n)
+	for i, arg := range args {
+		id, err := contracts.ParseID(arg)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func get(store contracts.Store, args []string) error {
+	ids, err := parseIDs(args, 1)
+	if err != nil {
+		return err
+	}
+	data, err := store.Get(ids[0])
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+func put(store contracts.Store, args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) == 2 {
+		file, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("Opening contract file: %w", err)
+		}
+		defer file.Close()
+		r, args = file, args[:1]
+	}
+	ids, err := parseIDs(args, 1)
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("Reading contract: %w", err)
+	}
+	var data contracts.Data
+	if err := json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("Parsing contract: %w", err)
+	}
+	return store.Put(ids[0], data)
+}
+
+func list(store contracts.Store, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected an environment")
+	}
+	systems, err := store.List(args[0])
+	if err != nil {
+		return err
+	}
+	for _, system := range systems {
+		data, err := store.Get(contracts.ID{
+			Environment: args[0],
+			System:      system,
+		})
+		if err != nil {
+			return err
+		}
+		fields := make([]string, 0, len(data))
+		for field := range data {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		fmt.Printf("%s\t%s\n", system, strings.Join(fields, ","))
+	}
+	return nil
+}
+
+func diff(store contracts.Store, args []string) error {
+	ids, err := parseIDs(args, 2)
+	if err != nil {
+		return err
+	}
+	old, err := store.Get(ids[0])
+	if err != nil {
+		return err
+	}
+	new, err := store.Get(ids[1])
+	if err != nil {
+		return err
+	}
+
+	for _, d := range contracts.Diff(old, new) {
+		switch {
+		case d.Added():
+			fmt.Printf("+ %s: %s\n", d.Field, encode(d.New))
+		case d.Removed():
+			fmt.Printf("- %s: %s\n", d.Field, encode(d.Old))
+		default:
+			fmt.Printf(
+				"~ %s: %s -> %s\n",
+				d.Field,
+				encode(d.Old),
+				encode(d.New),
+			)
+		}
+	}
+	return nil
+}
+
+// encode returns the compact JSON encoding of a field's value.
+func encode(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
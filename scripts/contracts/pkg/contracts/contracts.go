@@ -0,0 +1,95 @@
+// Package contracts reads and writes the data which systems share through the
+// environment contracts buckets (see `modules/contract` and
+// `modules/workload`).
+//
+// A contract is the JSON object which a system exports in an environment. It
+// lives in the environment's contract bucket (`Bucket`) under the system's
+// contract key (`Key`), `<environment>/<system>`. These mirror the
+// `contract_bucket` and `contract_key` outputs of `modules/workload`, from
+// which `modules/contract/import` reads, and the object which
+// `modules/contract/export` writes.
+package contracts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned when a contract doesn't exist.
+var ErrNotFound = errors.New("contract not found")
+
+// Bucket returns the name of the environment's contract bucket. It mirrors
+// the `contract_bucket` output of `modules/workload`.
+func Bucket(environment string) string {
+	return fmt.Sprintf("weberc2-%s-contracts", environment)
+}
+
+// Key returns the key of the contract within its environment's contract
+// bucket: `<environment>/<system>`. It mirrors the `contract_key` output of
+// `modules/workload`. `ParseID` parses it.
+func Key(id ID) string {
+	return id.String()
+}
+
+// ID identifies the contract which a system exports in an environment.
+type ID struct {
+	// Environment is the environment (e.g., `prd`).
+	Environment string
+
+	// System is the exporting system (e.g., `lambda-support`).
+	System string
+}
+
+// ParseID parses an ID of the form `<environment>/<system>`.
+func ParseID(s string) (ID, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ID{}, fmt.Errorf(
+			"invalid contract '%s': expected <environment>/<system>",
+			s,
+		)
+	}
+	return ID{Environment: parts[0], System: parts[1]}, nil
+}
+
+// String returns the ID as `<environment>/<system>`.
+func (id ID) String() string {
+	return id.Environment + "/" + id.System
+}
+
+// systemOfKey returns the system whose contract is at `key` in the
+// environment's contract bucket.
+func systemOfKey(environment, key string) (string, error) {
+	id, err := ParseID(key)
+	if err != nil {
+		return "", fmt.Errorf("Parsing contract key: %w", err)
+	}
+	if id.Environment != environment {
+		return "", fmt.Errorf(
+			"contract key '%s' doesn't belong to environment '%s'",
+			key,
+			environment,
+		)
+	}
+	return id.System, nil
+}
+
+// Data is the contents of a contract: the `data` argument of
+// `modules/contract/export`.
+type Data map[string]interface{}
+
+// Store is a collection of contracts.
+type Store interface {
+	// Get returns the contract's data. It returns an error wrapping
+	// `ErrNotFound` if the contract doesn't exist.
+	Get(id ID) (Data, error)
+
+	// Put creates or replaces the contract's data.
+	Put(id ID, data Data) error
+
+	// List returns the sorted systems which export contracts in the
+	// environment. It returns an error if a key in the environment's bucket
+	// isn't a contract key of the environment (see `Key`).
+	List(environment string) ([]string, error)
+}
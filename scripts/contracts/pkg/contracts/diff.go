@@ -0,0 +1,63 @@
+package contracts
+
+import (
+	"reflect"
+	"sort"
+)
+
+// FieldDiff is a difference between the values of a field in two contracts.
+type FieldDiff struct {
+	// Field is the name of the field.
+	Field string
+
+	// Old is the field's value in the first contract. It's nil if the field
+	// was added (or if its value is JSON null; see `InOld`).
+	Old interface{}
+
+	// New is the field's value in the second contract. It's nil if the field
+	// was removed (or if its value is JSON null; see `InNew`).
+	New interface{}
+
+	// InOld reports whether the field is in the first contract.
+	InOld bool
+
+	// InNew reports whether the field is in the second contract.
+	InNew bool
+}
+
+// Added reports whether the field is only in the second contract.
+func (diff *FieldDiff) Added() bool { return !diff.InOld }
+
+// Removed reports whether the field is only in the first contract.
+func (diff *FieldDiff) Removed() bool { return !diff.InNew }
+
+// Diff returns the fields whose values differ between two contracts sorted by
+// field name.
+func Diff(old, new Data) []FieldDiff {
+	var diffs []FieldDiff
+	for field, value := range old {
+		newValue, inNew := new[field]
+		if !inNew || !reflect.DeepEqual(value, newValue) {
+			diffs = append(diffs, FieldDiff{
+				Field: field,
+				Old:   value,
+				New:   newValue,
+				InOld: true,
+				InNew: inNew,
+			})
+		}
+	}
+	for field, value := range new {
+		if _, found := old[field]; !found {
+			diffs = append(diffs, FieldDiff{
+				Field: field,
+				New:   value,
+				InNew: true,
+			})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Field < diffs[j].Field
+	})
+	return diffs
+}
@@ -0,0 +1,38 @@
+package contracts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	diffs := Diff(
+		Data{"same": 1.0, "changed": "a", "removed": "x", "nulled": nil},
+		Data{"same": 1.0, "changed": "b", "added": nil, "nulled": nil},
+	)
+	wanted := []FieldDiff{
+		{Field: "added", InNew: true},
+		{Field: "changed", Old: "a", New: "b", InOld: true, InNew: true},
+		{Field: "removed", Old: "x", InOld: true},
+	}
+	if !reflect.DeepEqual(diffs, wanted) {
+		t.Fatalf("Wanted %+v; found %+v", wanted, diffs)
+	}
+	if !diffs[0].Added() || diffs[0].Removed() {
+		t.Error("Wanted a null field which is only in the new contract to " +
+			"be added")
+	}
+	if diffs[1].Added() || diffs[1].Removed() {
+		t.Error("Wanted a changed field to be neither added nor removed")
+	}
+	if diffs[2].Added() || !diffs[2].Removed() {
+		t.Error("Wanted a field which is only in the old contract to be " +
+			"removed")
+	}
+
+	// A field which becomes null is changed rather than removed.
+	diffs = Diff(Data{"field": "a"}, Data{"field": nil})
+	if len(diffs) != 1 || diffs[0].Added() || diffs[0].Removed() {
+		t.Fatalf("Wanted a single changed field; found %+v", diffs)
+	}
+}
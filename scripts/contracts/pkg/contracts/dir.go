@@ -0,0 +1,100 @@
+package contracts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DirStore is a `Store` backed by a local directory for offline use and
+// tests. It mirrors the layout of the contract buckets: each contract is a
+// JSON file at `<Dir>/<bucket>/<key>`.
+type DirStore struct {
+	// Dir is the directory which holds the contracts.
+	Dir string
+}
+
+func (store *DirStore) path(id ID) string {
+	return filepath.Join(
+		store.Dir,
+		Bucket(id.Environment),
+		filepath.FromSlash(Key(id)),
+	)
+}
+
+// Get implements `Store.Get`.
+func (store *DirStore) Get(id ID) (Data, error) {
+	content, err := ioutil.ReadFile(store.path(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("Getting contract '%s': %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("Getting contract '%s': %w", id, err)
+	}
+	var data Data
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("Parsing contract '%s': %w", id, err)
+	}
+	return data, nil
+}
+
+// Put implements `Store.Put`.
+func (store *DirStore) Put(id ID, data Data) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Encoding contract '%s': %w", id, err)
+	}
+	filePath := store.path(id)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("Putting contract '%s': %w", id, err)
+	}
+	if err := ioutil.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("Putting contract '%s': %w", id, err)
+	}
+	return nil
+}
+
+// List implements `Store.List`.
+func (store *DirStore) List(environment string) ([]string, error) {
+	dir := filepath.Join(store.Dir, Bucket(environment))
+	var systems []string
+	err := filepath.WalkDir(dir, func(
+		filePath string,
+		entry fs.DirEntry,
+		err error,
+	) error {
+		if err != nil {
+			if filePath == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		key, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		system, err := systemOfKey(environment, filepath.ToSlash(key))
+		if err != nil {
+			return err
+		}
+		systems = append(systems, system)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Listing contracts in environment '%s': %w",
+			environment,
+			err,
+		)
+	}
+	sort.Strings(systems)
+	return systems, nil
+}
@@ -0,0 +1,97 @@
+package contracts
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newDirStore(t *testing.T) *DirStore {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "contracts-test")
+	if err != nil {
+		t.Fatalf("Creating temporary directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &DirStore{Dir: dir}
+}
+
+func TestKey(t *testing.T) {
+	id := ID{Environment: "prd", System: "lambda-support"}
+	// The key matches the object which `modules/contract/export` writes.
+	if key := Key(id); key != "prd/lambda-support" {
+		t.Fatalf("Wanted 'prd/lambda-support'; found '%s'", key)
+	}
+	parsed, err := ParseID(Key(id))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parsed != id {
+		t.Fatalf("Wanted %v; found %v", id, parsed)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	store := newDirStore(t)
+	a := ID{Environment: "prd", System: "a"}
+	b := ID{Environment: "prd", System: "b"}
+
+	if _, err := store.Get(a); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Wanted ErrNotFound; found %v", err)
+	}
+	if systems, err := store.List("prd"); err != nil || len(systems) > 0 {
+		t.Fatalf("Wanted no systems; found %v (error: %v)", systems, err)
+	}
+
+	for _, id := range []ID{b, a, {Environment: "dev", System: "c"}} {
+		if err := store.Put(id, Data{"system": id.System}); err != nil {
+			t.Fatalf("Putting '%s': %v", id, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(
+		store.Dir,
+		"weberc2-prd-contracts",
+		"prd",
+		"a",
+	)); err != nil {
+		t.Fatalf("Wanted the contract at its bucket key: %v", err)
+	}
+
+	data, err := store.Get(a)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if wanted := (Data{"system": "a"}); !reflect.DeepEqual(data, wanted) {
+		t.Fatalf("Wanted %v; found %v", wanted, data)
+	}
+
+	systems, err := store.List("prd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if wanted := []string{"a", "b"}; !reflect.DeepEqual(systems, wanted) {
+		t.Fatalf("Wanted %v; found %v", wanted, systems)
+	}
+}
+
+func TestDirStoreListInvalidKey(t *testing.T) {
+	store := newDirStore(t)
+	bucket := filepath.Join(store.Dir, Bucket("prd"))
+	if err := os.MkdirAll(bucket, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A key from before contract keys were prefixed with the environment.
+	if err := ioutil.WriteFile(
+		filepath.Join(bucket, "a"),
+		[]byte("{}"),
+		0644,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.List("prd"); err == nil {
+		t.Fatal("Wanted an error for a key which isn't a contract key")
+	}
+}
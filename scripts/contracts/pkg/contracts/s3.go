@@ -0,0 +1,107 @@
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// S3Store is a `Store` backed by the environments' contract buckets.
+type S3Store struct {
+	// S3 is an S3 client.
+	S3 s3iface.S3API
+}
+
+// Get implements `Store.Get`.
+func (store *S3Store) Get(id ID) (Data, error) {
+	out, err := store.S3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(Bucket(id.Environment)),
+		Key:    aws.String(Key(id)),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, fmt.Errorf("Getting contract '%s': %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("Getting contract '%s': %w", id, err)
+	}
+	defer out.Body.Close()
+
+	content, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Reading contract '%s': %w", id, err)
+	}
+	var data Data
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("Parsing contract '%s': %w", id, err)
+	}
+	return data, nil
+}
+
+// Put implements `Store.Put`.
+func (store *S3Store) Put(id ID, data Data) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Encoding contract '%s': %w", id, err)
+	}
+	if _, err := store.S3.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(Bucket(id.Environment)),
+		Key:         aws.String(Key(id)),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String("application/json"),
+	}); err != nil {
+		return fmt.Errorf("Putting contract '%s': %w", id, err)
+	}
+	return nil
+}
+
+// List implements `Store.List`.
+func (store *S3Store) List(environment string) ([]string, error) {
+	var systems []string
+	var keyErr error
+	if err := store.S3.ListObjectsV2Pages(
+		// Only the environment's contracts live under its prefix; the
+		// bucket may hold unrelated objects.
+		&s3.ListObjectsV2Input{
+			Bucket: aws.String(Bucket(environment)),
+			Prefix: aws.String(environment + "/"),
+		},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, object := range page.Contents {
+				system, err := systemOfKey(
+					environment,
+					aws.StringValue(object.Key),
+				)
+				if err != nil {
+					keyErr = err
+					return false
+				}
+				systems = append(systems, system)
+			}
+			return true
+		},
+	); err != nil {
+		return nil, fmt.Errorf(
+			"Listing contracts in environment '%s': %w",
+			environment,
+			err,
+		)
+	}
+	if keyErr != nil {
+		return nil, fmt.Errorf(
+			"Listing contracts in environment '%s': %w",
+			environment,
+			keyErr,
+		)
+	}
+	sort.Strings(systems)
+	return systems, nil
+}
@@ -0,0 +1,109 @@
+package contracts
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// fakeS3 is an in-memory `s3iface.S3API` which implements the operations
+// which `S3Store` uses. Listings return one object per page.
+type fakeS3 struct {
+	s3iface.S3API
+
+	// objects holds object contents keyed by bucket and then by key.
+	objects map[string]map[string][]byte
+}
+
+func (fake *fakeS3) GetObject(
+	input *s3.GetObjectInput,
+) (*s3.GetObjectOutput, error) {
+	bucket := fake.objects[aws.StringValue(input.Bucket)]
+	data, found := bucket[aws.StringValue(input.Key)]
+	if !found {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "no such key", nil)
+	}
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(data)),
+	}, nil
+}
+
+func (fake *fakeS3) PutObject(
+	input *s3.PutObjectInput,
+) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	bucket := aws.StringValue(input.Bucket)
+	if fake.objects[bucket] == nil {
+		fake.objects[bucket] = map[string][]byte{}
+	}
+	fake.objects[bucket][aws.StringValue(input.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (fake *fakeS3) ListObjectsV2Pages(
+	input *s3.ListObjectsV2Input,
+	f func(*s3.ListObjectsV2Output, bool) bool,
+) error {
+	var keys []string
+	for key := range fake.objects[aws.StringValue(input.Bucket)] {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if !f(&s3.ListObjectsV2Output{
+			Contents: []*s3.Object{{Key: aws.String(key)}},
+		}, i == len(keys)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: map[string]map[string][]byte{
+		// Objects outside of the environment's prefix aren't contracts.
+		Bucket("prd"): {"README": []byte("unrelated")},
+	}}
+	store := &S3Store{S3: fake}
+	a := ID{Environment: "prd", System: "a"}
+	b := ID{Environment: "prd", System: "b"}
+
+	if _, err := store.Get(a); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Wanted ErrNotFound; found %v", err)
+	}
+	for _, id := range []ID{b, a, {Environment: "dev", System: "c"}} {
+		if err := store.Put(id, Data{"system": id.System}); err != nil {
+			t.Fatalf("Putting '%s': %v", id, err)
+		}
+	}
+
+	data, err := store.Get(a)
+	if err != nil {
+		t.Fatalf("Getting '%s': %v", a, err)
+	}
+	if wanted := (Data{"system": "a"}); !reflect.DeepEqual(data, wanted) {
+		t.Fatalf("Wanted %v; found %v", wanted, data)
+	}
+
+	systems, err := store.List("prd")
+	if err != nil {
+		t.Fatalf("Listing systems: %v", err)
+	}
+	if wanted := []string{"a", "b"}; !reflect.DeepEqual(systems, wanted) {
+		t.Fatalf("Wanted %v; found %v", wanted, systems)
+	}
+}
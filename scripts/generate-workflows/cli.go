@@ -0,0 +1,498 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+// Exit codes. Every command exits with `exitError` on failure and
+// `exitUsage` if it was invoked incorrectly; `check` exits with
+// `exitOutOfDate` if the workflows directory doesn't match the generator's
+// output.
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitOutOfDate = 3
+)
+
+// exitCodeError is an error which causes the program to exit with a specific
+// code.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (err *exitCodeError) Error() string { return err.err.Error() }
+func (err *exitCodeError) Unwrap() error { return err.err }
+
+// usageErrorf returns an error which causes the program to print its usage
+// and exit with `exitUsage`.
+func usageErrorf(format string, v ...interface{}) error {
+	return &exitCodeError{code: exitUsage, err: fmt.Errorf(format, v...)}
+}
+
+// listFlag is a flag which may be repeated and whose values may be
+// comma-separated.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+var (
+	repoRootFlag = flag.String(
+		"repo-root",
+		"",
+		"the repository `directory` (default: the nearest ancestor of the "+
+			"working directory which contains .git)",
+	)
+	outDir = flag.String(
+		"out",
+		"",
+		"the workflows `directory` (default: <repo-root>/.github/workflows)",
+	)
+	configPath = flag.String(
+		"config",
+		"",
+		"a YAML config `file` with defaults for -branches, -layout, "+
+			"-pin-actions, -project, -schedule, and -type",
+	)
+	pinActions = flag.Bool(
+		"pin-actions",
+		false,
+		"rewrite 'uses' references to the commit SHAs in the action lockfile",
+	)
+	actionLockFlag = flag.String(
+		"action-lock",
+		"",
+		"the action lock `file` which must have an entry for every 'uses' "+
+			"reference (default: <repo-root>/"+actionLockPath+")",
+	)
+	layout = flag.String(
+		"layout",
+		projects.LayoutWorkflow.String(),
+		"how jobs are distributed among workflow files: 'workflow' (one "+
+			"file per workflow), 'project' (one file per workflow per "+
+			"project), or 'project-type' (one file per workflow per project "+
+			"type)",
+	)
+	schedule = flag.String(
+		"schedule",
+		projects.DefaultSchedule,
+		"the cron `schedule` (in UTC) of the scheduled workflows (e.g., "+
+			"drift detection)",
+	)
+	branches        listFlag
+	projectPatterns listFlag
+	projectTypeIDs  listFlag
+)
+
+func init() {
+	flag.Var(
+		&branches,
+		"branches",
+		"the `branches` whose pull requests and pushes trigger workflows "+
+			"(comma-separated or repeated; default: "+
+			strings.Join(projects.DefaultBranches, ",")+")",
+	)
+	flag.Var(
+		&projectPatterns,
+		"project",
+		"only include projects whose paths match the `pattern` (e.g., "+
+			"'apps/*'); may be comma-separated or repeated",
+	)
+	flag.Var(
+		&projectTypeIDs,
+		"type",
+		"only include projects of the `type` (e.g., 'golang'); may be "+
+			"comma-separated or repeated",
+	)
+	flag.Usage = usage
+}
+
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(env *environment, args []string) error
+}
+
+// commands are the subcommands of the CLI. The first is the default.
+var commands []command
+
+func init() {
+	// `commands` is initialized here rather than in its declaration since
+	// `help` refers to it.
+	commands = []command{
+		{
+			name:    "generate",
+			args:    "[DIR]",
+			summary: "render the workflows into the workflows directory",
+			run:     generate,
+		},
+		{
+			name: "check",
+			summary: "exit with status 3 and print a diff if the workflows " +
+				"directory is out of date",
+			run: check,
+		},
+		{
+			name:    "list",
+			summary: "list the projects in the repository",
+			run:     list,
+		},
+		{
+			name:    "graph",
+			summary: "print the project dependency graph in Graphviz DOT format",
+			run:     graph,
+		},
+		{
+			name: "affected",
+			args: "[FILE...]",
+			summary: "list the projects affected by changes to the files " +
+				"(default: the files changed since -base, or those read " +
+				"from stdin)",
+			run: affected,
+		},
+		{
+			name: "contracts",
+			summary: "report the fields which each Terraform contract's " +
+				"exporter provides and its importers use",
+			run: contracts,
+		},
+		{
+			name: "tags",
+			summary: "check that Terraform resources carry the tags of a " +
+				"'modules/workload' call",
+			run: tags,
+		},
+		{
+			name: "lock",
+			summary: "resolve the 'uses' references which have no entry in " +
+				"the action lockfile to commit SHAs and rewrite it",
+			run: lock,
+		},
+		{
+			name:    "watch",
+			summary: "regenerate the workflows whenever their inputs change",
+			run:     watch,
+		},
+		{
+			name:    "help",
+			summary: "print this help",
+			run: func(*environment, []string) error {
+				flag.CommandLine.SetOutput(os.Stdout)
+				usage()
+				return nil
+			},
+		},
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(
+		out,
+		"Usage: generate-workflows [FLAGS] [COMMAND] [ARGS]\n\n"+
+			"Generates GitHub Actions workflows from the projects.yaml files "+
+			"in the repository.\n\nCommands:\n",
+	)
+	for _, c := range commands {
+		fmt.Fprintf(
+			out,
+			"  %-20s %s\n",
+			strings.TrimSpace(c.name+" "+c.args),
+			c.summary,
+		)
+	}
+	fmt.Fprintf(
+		out,
+		"\nFlags may precede or follow the command.\n\nFlags:\n",
+	)
+	flag.PrintDefaults()
+	fmt.Fprintf(
+		out,
+		"\nExit status:\n"+
+			"  %d  success\n"+
+			"  %d  error\n"+
+			"  %d  invalid usage\n"+
+			"  %d  check found differences\n",
+		exitOK,
+		exitError,
+		exitUsage,
+		exitOutOfDate,
+	)
+}
+
+func main() {
+	flag.Parse()
+	cmd, args, err := parseCommand(flag.Args())
+	if err == nil {
+		err = configureOutput()
+	}
+	if err == nil {
+		var env *environment
+		if env, err = newEnvironment(); err == nil {
+			err = cmd.run(env, args)
+		}
+	}
+	if err == nil {
+		os.Exit(exitOK)
+	}
+
+	var codeErr *exitCodeError
+	if !errors.As(err, &codeErr) {
+		reportError(err)
+		os.Exit(exitError)
+	}
+	if codeErr.code == exitUsage {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(
+			os.Stderr,
+			"Run 'generate-workflows help' for usage.",
+		)
+	} else {
+		reportError(codeErr.err)
+	}
+	os.Exit(codeErr.code)
+}
+
+// parseCommand selects the command from the positional arguments and parses
+// any flags which follow it. For compatibility with the original interface,
+// a positional argument which names an existing directory is an output
+// directory for `generate`. Any other unknown argument is a usage error, so a
+// mistyped command never turns into an output directory.
+func parseCommand(args []string) (*command, []string, error) {
+	if len(args) < 1 {
+		return &commands[0], nil, nil
+	}
+
+	for i := range commands {
+		if commands[i].name == args[0] {
+			if err := flag.CommandLine.Parse(args[1:]); err != nil {
+				return nil, nil, err
+			}
+			return &commands[i], flag.Args(), nil
+		}
+	}
+
+	if info, err := os.Stat(args[0]); err == nil && info.IsDir() {
+		return &commands[0], args, nil
+	}
+	return nil, nil, usageErrorf("unknown command '%s'", args[0])
+}
+
+// environment is the state shared by the commands.
+type environment struct {
+	repoRoot string
+	outDir   string
+	file     fileConfig
+	setFlags map[string]struct{}
+}
+
+// fileConfig is the format of the -config file. Flags which are set on the
+// command line take precedence.
+type fileConfig struct {
+	Branches   []string `yaml:"branches"`
+	Layout     string   `yaml:"layout"`
+	PinActions bool     `yaml:"pin-actions"`
+	Projects   []string `yaml:"projects"`
+	Schedule   string   `yaml:"schedule"`
+	Types      []string `yaml:"types"`
+}
+
+func newEnvironment() (*environment, error) {
+	env := environment{setFlags: map[string]struct{}{}}
+	flag.Visit(func(f *flag.Flag) { env.setFlags[f.Name] = struct{}{} })
+
+	env.repoRoot = *repoRootFlag
+	if env.repoRoot == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("Getting working directory: %w", err)
+		}
+		if env.repoRoot, err = findRepoRoot(cwd); err != nil {
+			return nil, fmt.Errorf("Finding repo root: %w", err)
+		}
+	}
+	repoRoot, err := filepath.Abs(env.repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("Resolving repo root: %w", err)
+	}
+	env.repoRoot = repoRoot
+
+	env.outDir = filepath.Join(env.repoRoot, ".github/workflows")
+	if *outDir != "" {
+		if env.outDir, err = filepath.Abs(*outDir); err != nil {
+			return nil, fmt.Errorf("Resolving output directory: %w", err)
+		}
+	}
+
+	if *configPath != "" {
+		data, err := ioutil.ReadFile(*configPath)
+		if err != nil {
+			return nil, fmt.Errorf("Reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &env.file); err != nil {
+			return nil, fmt.Errorf(
+				"Parsing config file '%s': %w",
+				*configPath,
+				err,
+			)
+		}
+	}
+
+	return &env, nil
+}
+
+// actionLockPath returns the path to the action lockfile.
+func (env *environment) actionLockPath() string {
+	if *actionLockFlag != "" {
+		return *actionLockFlag
+	}
+	return filepath.Join(env.repoRoot, actionLockPath)
+}
+
+func (env *environment) isSet(name string) bool {
+	_, set := env.setFlags[name]
+	return set
+}
+
+// config builds the generator configuration from the flags, the config file,
+// and the built-in project types and static files.
+func (env *environment) config() (*projects.Config, error) {
+	config := projects.Config{
+		ProjectTypes: projectTypes,
+		Branches:     env.file.Branches,
+		PinActions:   env.file.PinActions,
+		Schedule:     env.file.Schedule,
+		Warn:         reportWarning,
+		Filter: projects.ProjectFilter{
+			Paths: env.file.Projects,
+			Types: env.file.Types,
+		},
+	}
+	if env.isSet("branches") {
+		config.Branches = branches
+	}
+	if env.isSet("schedule") {
+		config.Schedule = *schedule
+	}
+	if env.isSet("pin-actions") {
+		config.PinActions = *pinActions
+	}
+	if env.isSet("project") {
+		config.Filter.Paths = projectPatterns
+	}
+	if env.isSet("type") {
+		config.Filter.Types = projectTypeIDs
+	}
+	if err := config.Filter.Validate(); err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+
+	layoutName := *layout
+	if env.file.Layout != "" && !env.isSet("layout") {
+		layoutName = env.file.Layout
+	}
+	l, err := projects.ParseLayout(layoutName)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	config.Layout = l
+
+	// A missing lockfile is empty, so every action is reported as missing.
+	lock, err := projects.LoadActionLock(env.actionLockPath())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("Loading action lock: %w", err)
+	}
+	config.ActionLock = lock
+
+	staticFiles, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		return nil, fmt.Errorf("Opening static files: %w", err)
+	}
+	config.StaticFiles = staticFiles
+
+	if config.Generator, err = generatorHash(); err != nil {
+		return nil, err
+	}
+
+	// The static files' jobs run this program with the Go version of its
+	// `go.mod`.
+	version, err := goVersion(sourceFS, ".")
+	if err != nil {
+		return nil, err
+	}
+	if version != "" {
+		config.StaticVersions = map[string]string{"go": version}
+	}
+	return &config, nil
+}
+
+// findProjects finds the projects in the repository which are selected by the
+// configured filter.
+func (env *environment) findProjects() ([]projects.Project, error) {
+	config, err := env.config()
+	if err != nil {
+		return nil, err
+	}
+	found, err := env.discoverProjects(config)
+	if err != nil {
+		return nil, err
+	}
+	return projects.FilterProjects(found, &config.Filter), nil
+}
+
+// discoverProjects finds every project in the repository. Unlike `discover`,
+// it doesn't parse the files from which links among projects are derived.
+func (env *environment) discoverProjects(
+	config *projects.Config,
+) ([]projects.Project, error) {
+	found, err := projects.FindProjectsFS(
+		config.ProjectTypes,
+		os.DirFS(env.repoRoot),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Collecting projects: %w", err)
+	}
+	return found, nil
+}
+
+// discover finds every project in the repository and the links among them.
+func (env *environment) discover(
+	config *projects.Config,
+) ([]projects.Project, []projects.Link, error) {
+	found, err := env.discoverProjects(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	links, err := projects.FindLinks(
+		config.ProjectTypes,
+		os.DirFS(env.repoRoot),
+		found,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Finding project links: %w", err)
+	}
+	return found, links, nil
+}
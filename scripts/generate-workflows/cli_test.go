@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	dir := tempDir(t)
+	for _, testCase := range []struct {
+		name    string
+		args    []string
+		command string
+		rest    []string
+		err     bool
+	}{
+		{name: "default", command: "generate"},
+		{
+			name:    "command",
+			args:    []string{"generate", "out"},
+			command: "generate",
+			rest:    []string{"out"},
+		},
+		{
+			name:    "existing directory",
+			args:    []string{dir},
+			command: "generate",
+			rest:    []string{dir},
+		},
+		{name: "unknown command", args: []string{"chek"}, err: true},
+		{
+			name: "unknown path",
+			args: []string{"does/not/exist"},
+			err:  true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			cmd, rest, err := parseCommand(testCase.args)
+			if testCase.err {
+				if err == nil {
+					t.Fatalf("Wanted an error; found command '%s'", cmd.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cmd.name != testCase.command {
+				t.Errorf(
+					"Wanted command '%s'; found '%s'",
+					testCase.command,
+					cmd.name,
+				)
+			}
+			if len(rest) > 0 || len(testCase.rest) > 0 {
+				if !reflect.DeepEqual(rest, testCase.rest) {
+					t.Errorf(
+						"Wanted arguments %v; found %v",
+						testCase.rest,
+						rest,
+					)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/gitfs"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+var base = flag.String(
+	"base",
+	"",
+	"for affected, the `revision` (e.g., origin/master) against whose merge "+
+		"base with HEAD changed files are listed",
+)
+
+var quick = flag.Bool(
+	"quick",
+	false,
+	"for check, skip rendering if the inputs hash in the header of every "+
+		"generated workflow file is current (hand edits go unnoticed)",
+)
+
+// errorKindOutOfDate is the kind of the errors reported by `check`.
+const errorKindOutOfDate projects.ErrorKind = "out-of-date"
+
+// check implements the `check` command. It stages the generator's output into
+// a temporary directory exactly as `generate` would and compares it with the
+// workflows directory. With -quick, it first compares the inputs hashes in the
+// headers of the workflow files and only renders if they're stale.
+func check(env *environment, args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("check: unexpected arguments")
+	}
+	config, err := env.config()
+	if err != nil {
+		return err
+	}
+
+	hash, err := projects.InputsHash(config, os.DirFS(env.repoRoot))
+	if err != nil {
+		return fmt.Errorf("Hashing inputs: %w", err)
+	}
+	if *quick {
+		current, err := headersCurrent(env.outDir, hash)
+		if err != nil {
+			return err
+		}
+		if current {
+			success("Workflows are up to date (inputs hashes match)")
+			return nil
+		}
+	}
+
+	stagingDir, err := ioutil.TempDir("", "generate-workflows-check")
+	if err != nil {
+		return fmt.Errorf("Creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+	if err := stage(config, env.repoRoot, env.outDir, stagingDir); err != nil {
+		return err
+	}
+
+	actual, err := snapshotDir(env.outDir)
+	if err != nil {
+		return fmt.Errorf("Reading workflows directory: %w", err)
+	}
+	expected, err := snapshotDir(stagingDir)
+	if err != nil {
+		return fmt.Errorf("Reading staged files: %w", err)
+	}
+
+	diff := diffSnapshots(actual, expected)
+	if diff == "" {
+		success("Workflows are up to date")
+		return nil
+	}
+	if *outputFormat == formatText {
+		fmt.Print(diff)
+	}
+
+	var errs projects.ErrorList
+	for _, fileName := range sortedKeys(actual, expected) {
+		a, inActual := actual[fileName]
+		b, inExpected := expected[fileName]
+		if inActual && inExpected && a == b {
+			continue
+		}
+		var message string
+		switch oldHash, found := projects.ReadInputsHash(
+			strings.NewReader(a),
+		); {
+		case !inActual:
+			message = "file is missing"
+		case !inExpected:
+			message = "file is no longer generated"
+		case found && oldHash != hash:
+			message = "file was generated from different inputs"
+		default:
+			message = "file differs from the generator's output (was it " +
+				"edited by hand?)"
+		}
+		errs = append(errs, &projects.Error{
+			Kind: errorKindOutOfDate,
+			File: path.Join(".github/workflows", fileName),
+			Message: message + "; run generate-workflows and commit the " +
+				"results",
+		})
+	}
+	return &exitCodeError{
+		code: exitOutOfDate,
+		err:  fmt.Errorf("Workflows are out of date: %w", errs),
+	}
+}
+
+// changedSince returns the repo-relative paths of the files which changed
+// between the merge base of `base` and HEAD and the working tree.
+func changedSince(repoRoot, base string) ([]string, error) {
+	mergeBase, err := gitfs.Git(repoRoot, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("Finding merge base: %w", err)
+	}
+	// With -z, paths are NUL-terminated and aren't quoted, so paths with
+	// spaces or unusual characters survive.
+	changes, err := gitfs.Git(
+		repoRoot,
+		"diff",
+		"--name-only",
+		"-z",
+		strings.TrimSpace(string(mergeBase)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Listing changed files: %w", err)
+	}
+	var changedFiles []string
+	for _, filePath := range strings.Split(string(changes), "\x00") {
+		if filePath != "" {
+			changedFiles = append(changedFiles, filePath)
+		}
+	}
+	return changedFiles, nil
+}
+
+// headersCurrent reports whether every file in the managed files list of the
+// workflows directory `dir` exists and whether every one which carries an
+// inputs hash (at least one must) carries `hash`. Since the hash covers
+// everything which determines the generator's output, the files are then up
+// to date unless they were edited by hand.
+func headersCurrent(dir, hash string) (bool, error) {
+	managed, err := readManagedFiles(dir)
+	if err != nil {
+		return false, err
+	}
+	hashed := false
+	for fileName := range managed {
+		data, err := ioutil.ReadFile(filepath.Join(dir, fileName))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("Reading '%s': %w", fileName, err)
+		}
+		found, ok := projects.ReadInputsHash(bytes.NewReader(data))
+		if !ok {
+			continue
+		}
+		if found != hash {
+			return false, nil
+		}
+		hashed = true
+	}
+	return hashed, nil
+}
+
+// list implements the `list` command.
+func list(env *environment, args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("list: unexpected arguments")
+	}
+	found, err := env.findProjects()
+	if err != nil {
+		return err
+	}
+	return printProjects(found)
+}
+
+// graph implements the `graph` command.
+func graph(env *environment, args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("graph: unexpected arguments")
+	}
+	config, err := env.config()
+	if err != nil {
+		return err
+	}
+	found, links, err := env.discover(config)
+	if err != nil {
+		return err
+	}
+	fmt.Print(projects.DependencyGraph(
+		projects.FilterProjects(found, &config.Filter),
+		links,
+	))
+	return nil
+}
+
+// affected implements the `affected` command. The changed files are the
+// arguments if there are any, the files changed since the merge base of -base
+// and HEAD if it's set, and otherwise the lines of stdin.
+func affected(env *environment, args []string) error {
+	changedFiles := args
+	switch {
+	case len(args) > 0 && *base != "":
+		return usageErrorf("affected: -base and FILE arguments are exclusive")
+	case *base != "":
+		changes, err := changedSince(env.repoRoot, *base)
+		if err != nil {
+			return err
+		}
+		changedFiles = changes
+	case len(args) < 1:
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				changedFiles = append(changedFiles, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("Reading changed files: %w", err)
+		}
+	}
+
+	config, err := env.config()
+	if err != nil {
+		return err
+	}
+	// Dependents of the selected projects may be affected as well, so the
+	// filter is applied to the result rather than to the candidates.
+	found, links, err := env.discover(config)
+	if err != nil {
+		return err
+	}
+	return printProjects(projects.FilterProjects(
+		projects.AffectedProjects(found, links, changedFiles),
+		&config.Filter,
+	))
+}
+
+// printProjects prints one project per line as `<path> <type> <name>` or, in
+// JSON mode, a JSON array.
+func printProjects(found []projects.Project) error {
+	if *outputFormat == formatJSON {
+		out := make([]projects.ManifestProject, len(found))
+		for i := range found {
+			out[i] = projects.ManifestProject{
+				Name: found[i].Name(),
+				Path: found[i].Path,
+				Type: found[i].Type.Identifier,
+			}
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	for i := range found {
+		fmt.Printf(
+			"%s\t%s\t%s\n",
+			found[i].Path,
+			found[i].Type.Identifier,
+			found[i].Name(),
+		)
+	}
+	return nil
+}
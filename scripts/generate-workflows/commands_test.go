@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runGit runs git in `dir` and fails the test if it fails.
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(
+		os.Environ(),
+		"GIT_AUTHOR_NAME=test",
+		"GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test",
+		"GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Running git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestChangedSince(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	repoRoot := tempDir(t)
+	writeFiles(t, repoRoot, map[string]string{"a.txt": "a\n"})
+	runGit(t, repoRoot, "init", "-q")
+	runGit(t, repoRoot, "add", "-A")
+	runGit(t, repoRoot, "commit", "-q", "-m", "initial")
+	runGit(t, repoRoot, "tag", "base")
+
+	writeFiles(t, filepath.Join(repoRoot, "dir with spaces"), map[string]string{
+		"b \"quoted\".txt": "b\n",
+	})
+	writeFiles(t, repoRoot, map[string]string{"a.txt": "changed\n"})
+	runGit(t, repoRoot, "add", "-A")
+	runGit(t, repoRoot, "commit", "-q", "-m", "change")
+
+	changed, err := changedSince(repoRoot, "base")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wanted := []string{"a.txt", "dir with spaces/b \"quoted\".txt"}
+	if !reflect.DeepEqual(changed, wanted) {
+		t.Fatalf("Wanted %q; found %q", wanted, changed)
+	}
+}
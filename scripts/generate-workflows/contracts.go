@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+// contractReport describes a contract for the `contracts` command.
+type contractReport struct {
+	Contract  string             `json:"contract"`
+	Exporter  *contractEndpoint  `json:"exporter,omitempty"`
+	Importers []contractEndpoint `json:"importers"`
+	Missing   []*projects.Error  `json:"missing,omitempty"`
+	Unused    []*projects.Error  `json:"unused,omitempty"`
+}
+
+// contractEndpoint is a target which exports or imports a contract and the
+// fields which it provides or uses.
+type contractEndpoint struct {
+	Project string   `json:"project"`
+	Module  string   `json:"module"`
+	Fields  []string `json:"fields"`
+	Opaque  bool     `json:"opaque,omitempty"`
+}
+
+func newContractEndpoint(ref contractReference) contractEndpoint {
+	fields := make([]string, 0, len(ref.Fields))
+	for field := range ref.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return contractEndpoint{
+		Project: ref.project.Path,
+		Module:  ref.Call.Name,
+		Fields:  fields,
+		Opaque:  ref.Opaque,
+	}
+}
+
+func (endpoint *contractEndpoint) String() string {
+	fields := strings.Join(endpoint.Fields, ", ")
+	if endpoint.Opaque {
+		fields = "unknown"
+	}
+	return fmt.Sprintf(
+		"%s (module '%s'; fields: %s)",
+		endpoint.Project,
+		endpoint.Module,
+		fields,
+	)
+}
+
+// contracts implements the `contracts` command. It reports the exporter,
+// importers, and missing and unused fields of every contract among the
+// Terraform targets. It fails if any contract is imported but not exported or
+// if an importer uses a field which the exporter doesn't provide.
+func contracts(env *environment, args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("contracts: unexpected arguments")
+	}
+	config, err := env.config()
+	if err != nil {
+		return err
+	}
+	repo := os.DirFS(env.repoRoot)
+	found, err := projects.FindProjectsFS(config.ProjectTypes, repo)
+	if err != nil {
+		return fmt.Errorf("Collecting projects: %w", err)
+	}
+	var targets []*projects.Project
+	for i := range found {
+		if found[i].Type.Identifier == terraformTargetIdentifier {
+			targets = append(targets, &found[i])
+		}
+	}
+
+	index, errs := loadContracts(repo, targets)
+	if len(errs) > 0 {
+		return fmt.Errorf("Loading contracts: %w", errs)
+	}
+
+	reports := []contractReport{}
+	for _, contract := range index.sortedContracts() {
+		report := contractReport{
+			Contract:  contract.String(),
+			Importers: []contractEndpoint{},
+		}
+		for _, imp := range index.importsOf(contract) {
+			report.Importers = append(report.Importers, newContractEndpoint(imp))
+			if _, found := index.exports[contract]; !found {
+				errs = append(errs, missingExporterError(imp))
+			}
+		}
+		if export, found := index.exports[contract]; found {
+			endpoint := newContractEndpoint(export)
+			report.Exporter = &endpoint
+
+			missing, unused := index.checkContractFields(contract)
+			for i := range missing {
+				report.Missing = append(report.Missing, missing[i].error())
+			}
+			for i := range unused {
+				report.Unused = append(report.Unused, unused[i].error())
+			}
+			errs = append(errs, report.Missing...)
+		}
+		reports = append(reports, report)
+	}
+
+	if err := printContractReports(reports); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Checking contracts: %w", errs)
+	}
+	return nil
+}
+
+func printContractReports(reports []contractReport) error {
+	if *outputFormat == formatJSON {
+		data, err := json.Marshal(reports)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	for _, report := range reports {
+		fmt.Println(report.Contract)
+		if report.Exporter != nil {
+			fmt.Printf("  exporter: %s\n", report.Exporter)
+		} else {
+			fmt.Println("  exporter: none")
+		}
+		for i := range report.Importers {
+			fmt.Printf("  importer: %s\n", &report.Importers[i])
+		}
+		for _, e := range report.Missing {
+			fmt.Printf("  missing:  %s\n", e)
+		}
+		for _, e := range report.Unused {
+			fmt.Printf("  unused:   %s\n", e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock on the file at `path`, creating
+// it if necessary, and blocks until the lock is available. The returned
+// function releases the lock. The operating system releases the lock if the
+// process dies, so a crashed run never leaves a stale lock behind.
+func lockFile(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Opening lock file '%s': %w", path, err)
+	}
+	fd := int(file.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("Locking '%s': %w", path, err)
+		}
+		warning("Waiting for another run to release '%s'", path)
+		if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Locking '%s': %w", path, err)
+		}
+	}
+	return func() {
+		syscall.Flock(fd, syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
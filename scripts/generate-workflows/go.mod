@@ -4,6 +4,11 @@ go 1.16
 
 require (
 	github.com/fatih/color v1.10.0
+	github.com/hashicorp/hcl/v2 v2.10.0
 	github.com/sirupsen/logrus v1.8.1
+	github.com/weberc2/infra/scripts/plan-policy v0.0.0
+	github.com/zclconf/go-cty v1.8.0
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
+
+replace github.com/weberc2/infra/scripts/plan-policy => ../plan-policy
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+// golangPaths implements `projects.ProjectType.Paths` for Go projects. A Go
+// project depends on the directories of the local modules which its `go.mod`
+// substitutes with `replace` directives (e.g., `replace example.com/foo =>
+// ../foo`), so changes to them affect the project.
+func golangPaths(repo fs.FS, project *projects.Project) ([]string, error) {
+	modFile := path.Join(project.Path, "go.mod")
+	data, err := fs.ReadFile(repo, modFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Reading '%s': %w", modFile, err)
+	}
+
+	var paths []string
+	inBlock := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		switch {
+		case len(fields) < 1:
+			continue
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case fields[0] == "replace" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+			continue
+		case fields[0] == "replace":
+			fields = fields[1:]
+		case !inBlock:
+			continue
+		}
+
+		// The replacement follows the arrow. Local replacements are
+		// directory paths which start with `./` or `../`.
+		arrow := indexOf(fields, "=>")
+		if arrow < 0 || arrow+1 >= len(fields) {
+			return nil, &projects.Error{
+				Kind:    projects.ErrorKindProjectFile,
+				File:    modFile,
+				Line:    line,
+				Message: "invalid replace directive",
+			}
+		}
+		replacement := fields[arrow+1]
+		if !strings.HasPrefix(replacement, "./") &&
+			!strings.HasPrefix(replacement, "../") {
+			continue
+		}
+		dir := path.Join(project.Path, replacement)
+		if dir == ".." || strings.HasPrefix(dir, "../") {
+			return nil, &projects.Error{
+				Kind: projects.ErrorKindProjectFile,
+				File: modFile,
+				Line: line,
+				Message: fmt.Sprintf(
+					"replacement '%s' is outside of the repository",
+					replacement,
+				),
+			}
+		}
+		paths = append(paths, dir)
+	}
+	return paths, scanner.Err()
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects/projectstest"
+)
+
+func TestGolangPaths(t *testing.T) {
+	for _, testCase := range []struct {
+		name  string
+		goMod string
+		paths []string
+		err   bool
+	}{
+		{name: "no replacements", goMod: "module foo\n\ngo 1.16\n"},
+		{
+			name: "local replacements",
+			goMod: `module foo
+
+go 1.16
+
+replace example.com/bar => ../bar // the bar library
+
+replace (
+	example.com/baz v1.0.0 => ./vendor/baz
+	example.com/qux => example.com/qux v1.2.3
+)
+`,
+			paths: []string{"scripts/bar", "scripts/foo/vendor/baz"},
+		},
+		{
+			name:  "outside of the repository",
+			goMod: "module foo\n\nreplace example.com/bar => ../../../bar\n",
+			err:   true,
+		},
+		{
+			name:  "invalid",
+			goMod: "module foo\n\nreplace example.com/bar\n",
+			err:   true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := projectstest.Repo{"scripts/foo/go.mod": testCase.goMod}
+			paths, err := golangPaths(
+				repo.FS(),
+				&projects.Project{Path: "scripts/foo"},
+			)
+			if testCase.err {
+				if err == nil {
+					t.Fatalf("Wanted an error; found paths %v", paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(paths, testCase.paths) {
+				t.Fatalf("Wanted %v; found %v", testCase.paths, paths)
+			}
+		})
+	}
+}
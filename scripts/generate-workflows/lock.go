@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/gitfs"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+// actionLockHeader precedes the entries of a new action lockfile.
+const actionLockHeader = `# Action lockfile
+#
+# Maps each 'uses' reference in the project types and static workflow files
+# to the full commit SHA to which it is pinned. Generation fails if any 'uses'
+# reference is missing from this file. Run 'generate-workflows lock' to
+# resolve missing entries.
+`
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// lock implements the `lock` command. It resolves each `uses` reference in
+// the project types and static files which has no entry in the action
+// lockfile with `git ls-remote` and rewrites the lockfile. Entries which are
+// no longer referenced are dropped.
+func lock(env *environment, args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("lock: unexpected arguments")
+	}
+	config, err := env.config()
+	if err != nil {
+		return err
+	}
+	found, err := env.discoverProjects(config)
+	if err != nil {
+		return err
+	}
+	staticFiles, err := projects.RenderStaticTemplates(
+		config.StaticFiles,
+		&projects.StaticData{
+			Projects: found,
+			Branches: projects.DefaultBranches,
+			Versions: config.StaticVersions,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("Rendering static files: %w", err)
+	}
+	references, err := projects.UsesReferences(
+		config.ProjectTypes,
+		staticFiles,
+	)
+	if err != nil {
+		return err
+	}
+
+	updated := make(projects.ActionLock, len(references))
+	for _, reference := range references {
+		if sha, found := config.ActionLock[reference]; found {
+			updated[reference] = sha
+			continue
+		}
+		sha, err := resolveAction(reference)
+		if err != nil {
+			return fmt.Errorf("Resolving '%s': %w", reference, err)
+		}
+		updated[reference] = sha
+		success("Locked %s to %s", reference, sha)
+	}
+
+	return writeActionLock(env.actionLockPath(), updated)
+}
+
+// resolveAction returns the commit SHA to which the ref of a `uses` reference
+// (e.g., `actions/checkout@v2`) points. Annotated tags are peeled.
+func resolveAction(reference string) (string, error) {
+	i := strings.LastIndex(reference, "@")
+	if i < 0 {
+		return "", fmt.Errorf("missing '@<ref>'")
+	}
+	actionPath, ref := reference[:i], reference[i+1:]
+	if commitSHAPattern.MatchString(ref) {
+		return ref, nil
+	}
+	// The action may live in a subdirectory of the repository (e.g.,
+	// `github/codeql-action/init`).
+	parts := strings.SplitN(actionPath, "/", 3)
+	if len(parts) < 2 {
+		return "", fmt.Errorf("expected '<owner>/<repo>[/<path>]'")
+	}
+
+	out, err := gitfs.Git(
+		".",
+		"ls-remote",
+		"https://github.com/"+parts[0]+"/"+parts[1],
+		"refs/tags/"+ref+"^{}",
+		"refs/tags/"+ref,
+		"refs/heads/"+ref,
+	)
+	if err != nil {
+		return "", err
+	}
+	shas := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			shas[fields[1]] = fields[0]
+		}
+	}
+	for _, name := range []string{
+		"refs/tags/" + ref + "^{}",
+		"refs/tags/" + ref,
+		"refs/heads/" + ref,
+	} {
+		if sha, found := shas[name]; found {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("no tag or branch named '%s'", ref)
+}
+
+// writeActionLock writes the lock to `filePath`, keeping the leading comment
+// of an existing lockfile.
+func writeActionLock(filePath string, lock projects.ActionLock) error {
+	header := actionLockHeader
+	existing, err := ioutil.ReadFile(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Reading action lock: %w", err)
+	}
+	if comment := leadingComment(existing); comment != "" {
+		header = comment
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(struct {
+		Actions projects.ActionLock `yaml:"actions"`
+	}{lock}); err != nil {
+		return fmt.Errorf("Encoding action lock: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("Encoding action lock: %w", err)
+	}
+	if err := ioutil.WriteFile(filePath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Writing action lock: %w", err)
+	}
+	return nil
+}
+
+// leadingComment returns the leading comment lines of a YAML document.
+func leadingComment(data []byte) string {
+	var sb strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
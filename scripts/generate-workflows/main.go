@@ -1,13 +1,10 @@
 package main
 
 import (
+	"embed"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
-
-	"github.com/fatih/color"
 
 	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
 )
@@ -23,101 +20,91 @@ func findRepoRoot(dir string) (string, error) {
 	return dir, nil
 }
 
-func main() {
-	if err := entrypoint(); err != nil {
-		chunks := strings.Split(err.Error(), ": ")
-		indent := ""
-		for _, chunk := range chunks {
-			color.Red("%s↪️ ️%s\n", indent, chunk)
-			indent += "  "
-		}
-		os.Exit(1)
-	}
-}
+// actionLockPath is the repo-relative path to the action lockfile (see
+// `projects.LoadActionLock`).
+const actionLockPath = generatorDir + "/actions.lock.yaml"
 
-func entrypoint() error {
-	// Create a temporary directory to represent the final
-	// `~/.github/workflows` directory. If all goes well, we'll do a rename at
-	// the end to atomically "promote" this temporary directory to become the
-	// official `~/.github/workflows` directory.
-	tmpDir, err := ioutil.TempDir("", "")
-	if err != nil {
-		return fmt.Errorf("Creating temp dir: %w", err)
+// generate implements the `generate` command. It renders the workflows into
+// the workflows directory or, with -rev or -against, prints them.
+func generate(env *environment, args []string) error {
+	if len(args) > 1 {
+		return usageErrorf("generate: too many arguments")
+	}
+	dir := env.outDir
+	if len(args) > 0 {
+		dir = args[0]
 	}
-	defer os.RemoveAll(tmpDir)
 
-	// Find the root of the repository
-	cwd, err := os.Getwd()
+	config, err := env.config()
 	if err != nil {
-		return fmt.Errorf("Getting working directory: %w", err)
+		return err
 	}
-	repoRoot, err := findRepoRoot(cwd)
-	if err != nil {
-		return fmt.Errorf("Finding repo root: %w", err)
+
+	if *rev != "" || *against != "" {
+		return renderRevisions(config, env.repoRoot)
 	}
 
-	dir := filepath.Join(repoRoot, ".github/workflows")
-	if len(os.Args) > 1 {
-		dir = os.Args[1]
+	// Render into a staging directory next to `~/.github/workflows`. If all
+	// goes well, `promote` renames the staging directory to become the
+	// official `~/.github/workflows` directory.
+	if err := promote(dir, func(stagingDir string) error {
+		return stage(config, env.repoRoot, dir, stagingDir)
+	}); err != nil {
+		return err
 	}
+	success("Promoted staged files")
+	return nil
+}
 
-	// Build and render project workflow files
-	if err := projects.RenderProjectWorkflows(projectTypes, repoRoot, tmpDir); err != nil {
+// stage renders everything that belongs in the workflows directory `dir` into
+// `stagingDir`.
+func stage(config *projects.Config, repoRoot, dir, stagingDir string) error {
+	// Build and render project workflow files, static files, and the checks
+	// manifest
+	if err := projects.RenderProjectWorkflows(
+		config,
+		repoRoot,
+		stagingDir,
+	); err != nil {
 		return fmt.Errorf("Rendering project workflows: %w", err)
 	}
 	success("Staged project workflows")
 
-	// Render the static files
-	for fileName, contents := range staticFiles {
-		filePath := filepath.Join(tmpDir, fileName)
-		if err := func() error {
-			file, err := os.Create(filePath)
-			if err != nil {
-				return fmt.Errorf("Creating static file '%s': %w", filePath, err)
-			}
-			defer file.Close()
-
-			if _, err := file.WriteString(contents); err != nil {
-				return fmt.Errorf("Writing to static file '%s': %w", filePath, err)
-			}
-			return nil
-		}(); err != nil {
-			return err
-		}
-		success("Staged %s", fileName)
-	}
-
-	// Atomically "commit" the changes to `~/.github/workflows`.
-	if err := os.Rename(tmpDir, dir); err != nil {
-		if os.IsExist(err) {
-			if err := os.RemoveAll(dir); err != nil {
-				return fmt.Errorf("Removing dir '%s': %w", dir, err)
-			}
-			if err := os.Rename(tmpDir, dir); err != nil {
-				return fmt.Errorf("Renaming '%s' to '%s': %w", tmpDir, dir, err)
-			}
-		} else {
-			return fmt.Errorf("Renaming '%s' to '%s': %w", tmpDir, dir, err)
-		}
+	// Carry over hand-written workflow files so that promotion only replaces
+	// or removes the files that the generator owns.
+	if err := stageUnmanagedFiles(dir, stagingDir); err != nil {
+		return fmt.Errorf("Staging unmanaged files: %w", err)
 	}
-	success("Promoted staged files")
+	success("Staged unmanaged files")
 	return nil
 }
 
 var golangProjectType = projects.ProjectType{
 	Identifier: "golang",
+	Paths:      golangPaths,
+	Versions:   golangVersions,
 	Workflows: projects.WorkflowTypes{
 		projects.WorkflowPullRequest: {golangTestJobType, golangLintJobType},
 		projects.WorkflowMerge:       {golangTestJobType, golangLintJobType},
 	},
 }
 
+// terraformSecrets are the credentials for the admin-level `terraform` IAM
+// user. Only job types which must manage or publish to AWS resources may
+// reference them.
+var terraformSecrets = []string{
+	"TERRAFORM_AWS_ACCESS_KEY_ID",
+	"TERRAFORM_AWS_SECRET_ACCESS_KEY",
+}
+
 var projectTypes = []projects.ProjectType{
 	{
 		Identifier: "golanglambda",
 		Dependencies: map[string]*projects.ProjectType{
 			"golang-source-project": &golangProjectType,
 		},
+		Paths:    golangPaths,
+		Versions: golangVersions,
 		Workflows: projects.WorkflowTypes{
 			projects.WorkflowPullRequest: {
 				{
@@ -138,7 +125,8 @@ var projectTypes = []projects.ProjectType{
 			},
 			projects.WorkflowMerge: {
 				{
-					Name: "s3publish",
+					Name:    "s3publish",
+					Secrets: terraformSecrets,
 					Dependencies: []projects.JobTypeDependency{{
 						Name:     "golang-source-project",
 						JobIndex: 0, // test
@@ -180,22 +168,34 @@ zip "${filePath}.zip" "$filePath"`,
 	},
 	golangProjectType,
 	{
-		Identifier: "terraformtarget",
+		Identifier: terraformTargetIdentifier,
+		Params:     []string{terraformEnvironmentsParam},
+		Links:      terraformContractLinks,
+		Paths:      terraformTargetPaths,
+		Versions:   terraformTargetVersions,
 		Workflows: projects.WorkflowTypes{
 			projects.WorkflowPullRequest: {
 				{
-					Name:   "plan",
-					RunsOn: "ubuntu-latest",
+					Name:    "plan",
+					Secrets: terraformSecrets,
+					RunsOn:  "ubuntu-latest",
+					ForEach: terraformEnvironmentsParam,
 					Steps: []projects.JobStep{
 						{Uses: "actions/checkout@v2"},
-						{Name: "Terraform setup", Uses: "hashicorp/setup-terraform@v1"},
+						{
+							Name: "Terraform setup",
+							Uses: "hashicorp/setup-terraform@v1",
+							// The wrapper decorates terraform's stdout, which
+							// would corrupt the JSON plan.
+							With: map[string]string{"terraform_wrapper": "false"},
+						},
 						{
 							Name: "Terraform init",
 							Env: map[string]string{
 								"AWS_ACCESS_KEY_ID":     "${{ secrets.TERRAFORM_AWS_ACCESS_KEY_ID }}",
 								"AWS_SECRET_ACCESS_KEY": "${{ secrets.TERRAFORM_AWS_SECRET_ACCESS_KEY }}",
 							},
-							Run: "terraform -chdir={{ .Path }} init",
+							Run: "terraform -chdir={{ .Path }} init" + terraformBackendFlags,
 						},
 						{
 							Name: "Terraform plan",
@@ -203,33 +203,258 @@ zip "${filePath}.zip" "$filePath"`,
 								"AWS_ACCESS_KEY_ID":     "${{ secrets.TERRAFORM_AWS_ACCESS_KEY_ID }}",
 								"AWS_SECRET_ACCESS_KEY": "${{ secrets.TERRAFORM_AWS_SECRET_ACCESS_KEY }}",
 							},
-							Run: "terraform -chdir={{ .Path }} plan",
+							Run: "terraform -chdir={{ .Path }} plan" + terraformVarFlags + " -out=tfplan",
+						},
+						{
+							Name: "Terraform show",
+							Run:  "terraform -chdir={{ .Path }} show -json tfplan > {{ .Path }}/tfplan.json",
+						},
+						{
+							Name: "Plan summary",
+							Run: `terraform -chdir={{ .Path }} show -no-color tfplan > {{ .Path }}/tfplan.txt
+{
+  echo "### Terraform plan for {{ .Path }}{{ if .Variant }} ({{ .Variant }}){{ end }}"
+  echo '` + "```" + `'
+  cat {{ .Path }}/tfplan.txt
+  echo '` + "```" + `'
+} >> $GITHUB_STEP_SUMMARY
+`,
+						},
+						{
+							// The apply job checks that it runs the same
+							// version of Terraform.
+							Name: "Record Terraform version",
+							Run:  "terraform version -json | jq -r .terraform_version > {{ .Path }}/tfplan.version",
+						},
+						{
+							Name: "Upload plan",
+							Uses: "actions/upload-artifact@v4",
+							With: map[string]string{
+								"name": terraformPlanArtifact,
+								"path": "{{ .Path }}/tfplan\n{{ .Path }}/tfplan.version",
+							},
+						},
+						{Uses: "actions/setup-go@v2"},
+						{
+							Name: "Plan policy",
+							Run:  "(cd " + planPolicyDir + " && go run . -format=github -target={{ .Path }} $GITHUB_WORKSPACE/{{ .Path }}/tfplan.json)",
+						},
+					},
+				},
+				{
+					Name:   "tags",
+					RunsOn: "ubuntu-latest",
+					Steps: []projects.JobStep{
+						{Uses: "actions/checkout@v2"},
+						{
+							// The job runs this program, not the plan
+							// policy checker.
+							Uses: "actions/setup-go@v2",
+							With: map[string]string{
+								"go-version": `{{ index .Versions "` + generatorGoVersion + `" }}`,
+							},
+						},
+						{
+							Name: "Check workload tags",
+							Run:  "(cd " + generatorDir + " && go run . -format=github -project={{ .Path }} tags)",
 						},
 					},
 				},
 			},
 			projects.WorkflowMerge: {
 				{
-					Name:   "apply",
-					RunsOn: "ubuntu-latest",
+					Name:        "apply",
+					Secrets:     terraformSecrets,
+					RunsOn:      "ubuntu-latest",
+					ForEach:     terraformEnvironmentsParam,
+					Sequential:  true,
+					Environment: "{{ .Variant }}",
+					// The reviewed plan is found with the GitHub API.
+					Permissions: map[string]string{
+						"actions":       "read",
+						"contents":      "read",
+						"pull-requests": "read",
+					},
 					Steps: []projects.JobStep{
 						{Uses: "actions/checkout@v2"},
-						{Name: "Terraform setup", Uses: "hashicorp/setup-terraform@v1"},
+						{
+							Name: "Terraform setup",
+							Uses: "hashicorp/setup-terraform@v1",
+							// The wrapper decorates terraform's stdout, which
+							// would corrupt the version check.
+							With: map[string]string{"terraform_wrapper": "false"},
+						},
 						{
 							Name: "Terraform init",
 							Env: map[string]string{
 								"AWS_ACCESS_KEY_ID":     "${{ secrets.TERRAFORM_AWS_ACCESS_KEY_ID }}",
 								"AWS_SECRET_ACCESS_KEY": "${{ secrets.TERRAFORM_AWS_SECRET_ACCESS_KEY }}",
 							},
-							Run: "terraform -chdir={{ .Path }} init",
+							Run: "terraform -chdir={{ .Path }} init" + terraformBackendFlags,
 						},
 						{
+							// Find the plan which was reviewed in the pull
+							// request which introduced the merged commit.
+							Name: "Find reviewed plan",
+							ID:   "reviewed-plan",
+							Env: map[string]string{
+								"GH_TOKEN": "${{ secrets.GITHUB_TOKEN }}",
+							},
+							Run: `head_sha=$(gh api "repos/$GITHUB_REPOSITORY/commits/$GITHUB_SHA/pulls" --jq '.[0].head.sha // empty')
+if [ -z "$head_sha" ]; then
+  echo "::error::No pull request introduced $GITHUB_SHA, so there is no reviewed plan to apply"
+  exit 1
+fi
+artifact_id=$(gh api --paginate "repos/$GITHUB_REPOSITORY/actions/artifacts?name=` + terraformPlanArtifact + `&per_page=100" --jq ".artifacts[] | select(.workflow_run.head_sha == \"$head_sha\" and (.expired | not)) | .id" | head -n 1)
+if [ -z "$artifact_id" ]; then
+  echo "::error::No reviewed plan artifact '` + terraformPlanArtifact + `' was found for the pull request's head commit $head_sha (it may have expired, or the plan job may have failed); re-run the pull request's plan job and merge again"
+  exit 1
+fi
+echo "artifact-id=$artifact_id" >> $GITHUB_OUTPUT
+`,
+						},
+						{
+							Name: "Download reviewed plan",
+							Env: map[string]string{
+								"GH_TOKEN": "${{ secrets.GITHUB_TOKEN }}",
+							},
+							Run: `gh api "repos/$GITHUB_REPOSITORY/actions/artifacts/${{ steps.reviewed-plan.outputs.artifact-id }}/zip" > tfplan.zip
+unzip -o tfplan.zip -d {{ .Path }}
+if [ ! -f {{ .Path }}/tfplan ] || [ ! -f {{ .Path }}/tfplan.version ]; then
+  echo "::error::The reviewed plan artifact '` + terraformPlanArtifact + `' has no plan or no Terraform version"
+  exit 1
+fi
+planned=$(cat {{ .Path }}/tfplan.version)
+installed=$(terraform version -json | jq -r .terraform_version)
+if [ "$planned" != "$installed" ]; then
+  echo "::error::The reviewed plan was made with Terraform $planned, but Terraform $installed is installed"
+  exit 1
+fi
+`,
+						},
+						{
+							// Applying a saved plan fails if the state has
+							// changed since the plan was made.
 							Name: "Terraform apply",
 							Env: map[string]string{
 								"AWS_ACCESS_KEY_ID":     "${{ secrets.TERRAFORM_AWS_ACCESS_KEY_ID }}",
 								"AWS_SECRET_ACCESS_KEY": "${{ secrets.TERRAFORM_AWS_SECRET_ACCESS_KEY }}",
 							},
-							Run: "terraform -chdir={{ .Path }} apply",
+							Run: "terraform -chdir={{ .Path }} apply -input=false tfplan",
+						},
+					},
+				},
+			},
+			projects.WorkflowDrift: {
+				{
+					Name:    "drift",
+					Secrets: terraformSecrets,
+					RunsOn:  "ubuntu-latest",
+					ForEach: terraformEnvironmentsParam,
+					Steps: []projects.JobStep{
+						{Uses: "actions/checkout@v2"},
+						{
+							Name: "Terraform setup",
+							Uses: "hashicorp/setup-terraform@v1",
+							// The wrapper would hide the plan's exit code.
+							With: map[string]string{"terraform_wrapper": "false"},
+						},
+						{
+							Name: "Terraform init",
+							Env: map[string]string{
+								"AWS_ACCESS_KEY_ID":     "${{ secrets.TERRAFORM_AWS_ACCESS_KEY_ID }}",
+								"AWS_SECRET_ACCESS_KEY": "${{ secrets.TERRAFORM_AWS_SECRET_ACCESS_KEY }}",
+							},
+							Run: "terraform -chdir={{ .Path }} init" + terraformBackendFlags,
+						},
+						{
+							// `-detailed-exitcode` exits 0 if the
+							// infrastructure matches the configuration, 2 if
+							// it has drifted, and 1 on error. The state isn't
+							// locked so that drift detection never blocks an
+							// apply.
+							Name: "Detect drift",
+							Env: map[string]string{
+								"AWS_ACCESS_KEY_ID":     "${{ secrets.TERRAFORM_AWS_ACCESS_KEY_ID }}",
+								"AWS_SECRET_ACCESS_KEY": "${{ secrets.TERRAFORM_AWS_SECRET_ACCESS_KEY }}",
+							},
+							Run: `mkdir -p drift
+set +e
+terraform -chdir={{ .Path }} plan -detailed-exitcode -input=false -lock=false -no-color` + terraformVarFlags + ` > drift/` + terraformJobName + `.txt 2>&1
+code=$?
+set -e
+case $code in
+  0) status=clean ;;
+  2) status=drifted ;;
+  *) status=errored ;;
+esac
+jq -n --arg target {{ .Path }} --arg environment "{{ .Variant }}" --arg status $status --argjson exit_code $code --arg details ` + terraformJobName + `.txt '$ARGS.named' > drift/` + terraformJobName + `.json
+echo "{{ .Path }}{{ if .Variant }} ({{ .Variant }}){{ end }}: $status"
+`,
+						},
+						{
+							Name: "Upload drift report",
+							Uses: "actions/upload-artifact@v4",
+							With: map[string]string{
+								"name": "drift-" + terraformJobName,
+								"path": "drift/",
+							},
+						},
+					},
+				},
+			},
+		},
+		Aggregates: projects.WorkflowTypes{
+			projects.WorkflowDrift: {
+				{
+					// The report runs even if drift jobs fail; a job
+					// which failed before uploading its report (e.g., in
+					// `terraform init`) is reported as errored.
+					Name:   "drift-report",
+					RunsOn: "ubuntu-latest",
+					If:     "always()",
+					Steps: []projects.JobStep{
+						{
+							Name: "Download drift reports",
+							Uses: "actions/download-artifact@v4",
+							With: map[string]string{"path": "drift"},
+						},
+						{
+							Name: "Summarize drift",
+							ID:   "summary",
+							Env:  map[string]string{"NEEDS": "${{ toJSON(needs) }}"},
+							Run: `mkdir -p drift
+reports=$(find drift -name '*.json' -print0 | xargs -0 -r cat | jq -s 'sort_by(.target, .environment)')
+failed=$(echo "$NEEDS" | jq '[to_entries[] | select(.value.result != "success") | .key]')
+jq -n --argjson targets "$reports" --argjson failed_jobs "$failed" '$ARGS.named' > drift-report.json
+{
+  echo "### Terraform drift"
+  echo
+  echo "| Target | Environment | Status |"
+  echo "| --- | --- | --- |"
+  jq -r '.targets[] | "| \(.target) | \(.environment) | \(.status) |"' drift-report.json
+  jq -r '.failed_jobs[] | "| \(.) | | errored |"' drift-report.json
+} >> $GITHUB_STEP_SUMMARY
+if jq -e '(.failed_jobs | length) > 0 or any(.targets[]; .status != "clean")' drift-report.json > /dev/null; then
+  echo "drifted=true" >> $GITHUB_OUTPUT
+fi
+`,
+						},
+						{
+							Name: "Upload drift report",
+							Uses: "actions/upload-artifact@v4",
+							With: map[string]string{
+								"name": "drift-report",
+								"path": "drift-report.json\ndrift/",
+							},
+						},
+						{
+							Name: "Check drift",
+							Run: `if [ "${{ steps.summary.outputs.drifted }}" = true ]; then
+  echo "::error::Terraform targets have drifted or failed to plan; see the drift-report artifact"
+  exit 1
+fi
+`,
 						},
 					},
 				},
@@ -238,6 +463,52 @@ zip "${filePath}.zip" "$filePath"`,
 	},
 }
 
+// terraformJobName is the name of a Terraform target's job for its
+// environment, if any. It distinguishes the job's artifacts.
+const terraformJobName = "{{ .Name }}{{ if .Variant }}-{{ .Variant }}{{ end }}"
+
+// terraformPlanArtifact is the name of the artifact which holds a Terraform
+// target's saved plan. The pull request workflow uploads it and the merge
+// workflow applies it.
+const terraformPlanArtifact = terraformJobName + "-tfplan"
+
+// terraformEnvironmentsParam is the `projects.yaml` param which lists the
+// environments of a Terraform target, e.g.:
+//
+//	projects:
+//	  - type: terraformtarget
+//	    params:
+//	      environments: [dev, prd]
+//
+// Each environment gets its own plan and apply jobs. Applies run in the
+// listed order, each gated by the GitHub environment of the same name.
+//
+// A target with environments must follow two conventions:
+//
+//   - Each environment has a partial backend configuration in
+//     `environments/<environment>.tfbackend` (relative to the target) which
+//     is passed to `terraform init -backend-config=...`. It typically sets
+//     the state `key` so that the environments don't share a state file,
+//     e.g. `key = "foo/dev.tfstate"`. A missing file is reported when the
+//     workflows are generated rather than when CI runs `terraform init`.
+//   - The target declares a string variable named `environment`, which
+//     `terraform plan -var=environment=<environment>` sets. Contracts are
+//     resolved once per environment with `var.environment` bound to it, so
+//     a target may pass it to `modules/workload` or a contract import, and
+//     each environment's jobs are linked to the exporter's jobs of the
+//     contract's environment.
+//
+// Targets without the param have a single environment which is hard-coded
+// in their configuration.
+const terraformEnvironmentsParam = "environments"
+
+// terraformBackendFlags and terraformVarFlags are the `terraform init` and
+// `plan` flags which select a job's environment, if any.
+const (
+	terraformBackendFlags = "{{ if .Variant }} -backend-config=environments/{{ .Variant }}.tfbackend{{ end }}"
+	terraformVarFlags     = "{{ if .Variant }} -var=environment={{ .Variant }}{{ end }}"
+)
+
 var golangLintJobType = projects.JobType{
 	Name:   "lint",
 	RunsOn: "ubuntu-latest",
@@ -268,49 +539,8 @@ var golangTestJobType = projects.JobType{
 	},
 }
 
-var staticFiles = map[string]string{
-	"terraform-fmt.yaml": `name: Terraform format check
-
-on:
-  pull_request:
-    branches: [ master ]
-
-jobs:
-  format-check:
-    runs-on: ubuntu-latest
-    steps:
-      - uses: actions/checkout@v2
-      - name: Terraform setup
-        uses: hashicorp/setup-terraform@v1
-      - name: Terraform format check
-        run: terraform fmt -recursive -check
-`,
-	"generate-workflows-check.yaml": `name: Generate workflows check
-
-on:
-  pull_request:
-    branches: [ master ]
-
-jobs:
-  generate-workflows-check:
-    runs-on: ubuntu-latest
-    steps:
-      - uses: actions/checkout@v2
-      - uses: actions/setup-go@v2
-      - name: Run script
-        run: (cd scripts/generate-workflows && go run .)
-      - name: Check diff
-        run: |
-          if [[ -n "$(git diff .github/workflows)" ]]; then
-              echo "Unexpected differences in the .github/workflows directory:"
-              git diff .github/workflows
-              echo ""
-              echo "Run ./scripts/generate-workflows.go from the repo root and commit the results."
-              exit 1
-          fi
-`,
-}
-
-func success(format string, v ...interface{}) {
-	fmt.Printf("✅ "+format+"\n", v...)
-}
+// staticFS holds the hand-written workflow file templates. See
+// `projects.StaticData` for the data available to them.
+//
+//go:embed static
+var staticFS embed.FS
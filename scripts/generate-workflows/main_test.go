@@ -0,0 +1,207 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects/projectstest"
+)
+
+// TestProjectTypes renders a small repository for each built-in project type
+// and compares the output against the golden files in `testdata/golden`. Run
+// `go test . -update` to accept changes to the job definitions.
+func TestProjectTypes(t *testing.T) {
+	for _, testCase := range []struct {
+		name   string
+		layout projects.Layout
+		repo   projectstest.Repo
+	}{
+		{
+			name: "golang",
+			repo: projectstest.Repo{
+				"apps/foo/projects.yaml": "projects:\n  - type: golang\n",
+				"apps/foo/go.mod":        "module foo\n\ngo 1.16\n",
+			},
+		},
+		{
+			name: "golanglambda",
+			repo: projectstest.Repo{
+				"apps/foo/projects.yaml": `projects:
+  - type: golang
+  - type: golanglambda
+    dependencies:
+      golang-source-project:
+        path: apps/foo/
+        type: golang
+`,
+				"apps/foo/go.mod": "module foo\n\ngo 1.16\n",
+			},
+		},
+		{
+			name:   "golanglambda-project-layout",
+			layout: projects.LayoutProject,
+			repo: projectstest.Repo{
+				"apps/foo/projects.yaml": `projects:
+  - type: golang
+  - type: golanglambda
+    dependencies:
+      golang-source-project:
+        path: apps/foo/
+        type: golang
+`,
+				"apps/foo/go.mod":        "module foo\n\ngo 1.16\n",
+				"apps/bar/projects.yaml": "projects:\n  - type: golang\n",
+				"apps/bar/go.mod":        "module bar\n\ngo 1.16\n",
+			},
+		},
+		{
+			name:   "terraformtarget-contracts",
+			layout: projects.LayoutProject,
+			repo: projectstest.Repo{
+				"modules/workload/main.tf":        "",
+				"modules/contract/export/main.tf": "",
+				"modules/contract/import/main.tf": `module "target_workload" {
+  source = "../../workload"
+}
+`,
+				"scripts/generate-workflows/go.mod": "module gen\n\ngo 1.16\n",
+				"targets/exporter/projects.yaml":    "projects:\n  - type: terraformtarget\n",
+				"targets/exporter/main.tf": `module "workload" {
+  source      = "../../modules/workload"
+  environment = "prd"
+  system      = "exporter"
+}
+
+module "contract_export" {
+  source   = "../../modules/contract/export"
+  workload = module.workload
+  data     = { bucket_name = "foo" }
+}
+`,
+				"targets/importer/projects.yaml": "projects:\n  - type: terraformtarget\n",
+				"targets/importer/main.tf": `module "exporter" {
+  source        = "../../modules/contract/import"
+  environment   = "prd"
+  target_system = "exporter"
+}
+
+output "bucket_name" {
+  value = module.exporter.data.bucket_name
+}
+`,
+			},
+		},
+		{
+			name: "terraformtarget-environments-contracts",
+			repo: projectstest.Repo{
+				"modules/workload/main.tf":          "",
+				"modules/contract/export/main.tf":   "",
+				"modules/contract/import/main.tf":   "",
+				"scripts/generate-workflows/go.mod": "module gen\n\ngo 1.16\n",
+				"targets/exporter/projects.yaml": `projects:
+  - type: terraformtarget
+    params:
+      environments: [dev, prd]
+`,
+				"targets/exporter/environments/dev.tfbackend": "",
+				"targets/exporter/environments/prd.tfbackend": "",
+				"targets/exporter/main.tf": `variable "environment" {
+  type = string
+}
+
+module "workload" {
+  source      = "../../modules/workload"
+  environment = var.environment
+  system      = "exporter"
+}
+
+module "contract_export" {
+  source   = "../../modules/contract/export"
+  workload = module.workload
+  data     = { bucket_name = "foo" }
+}
+`,
+				"targets/importer/projects.yaml": `projects:
+  - type: terraformtarget
+    params:
+      environments: [dev, prd]
+`,
+				"targets/importer/environments/dev.tfbackend": "",
+				"targets/importer/environments/prd.tfbackend": "",
+				"targets/importer/main.tf": `variable "environment" {
+  type = string
+}
+
+module "exporter" {
+  source        = "../../modules/contract/import"
+  environment   = var.environment
+  target_system = "exporter"
+}
+
+output "bucket_name" {
+  value = module.exporter.data.bucket_name
+}
+`,
+			},
+		},
+		{
+			name: "terraformtarget-environments",
+			repo: projectstest.Repo{
+				"targets/foo/projects.yaml": `projects:
+  - type: terraformtarget
+    params:
+      environments: [dev, prd]
+`,
+				"targets/foo/main.tf":                    "",
+				"scripts/generate-workflows/go.mod":      "module gen\n\ngo 1.16\n",
+				"targets/foo/environments/dev.tfbackend": "",
+				"targets/foo/environments/prd.tfbackend": "",
+			},
+		},
+		{
+			name: "terraformtarget",
+			repo: projectstest.Repo{
+				"targets/foo/projects.yaml": "projects:\n  - type: terraformtarget\n",
+				"targets/foo/main.tf":       "",
+				"targets/foo/versions.tf": "terraform {\n" +
+					"  required_version = \"= 1.1.9\"\n" +
+					"}\n",
+				"scripts/plan-policy/go.mod":        "module policy\n\ngo 1.16\n",
+				"scripts/generate-workflows/go.mod": "module gen\n\ngo 1.17\n",
+			},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			projectstest.AssertGolden(
+				t,
+				filepath.Join("testdata", "golden", testCase.name),
+				projectstest.Render(
+					t,
+					&projects.Config{
+						ProjectTypes: projectTypes,
+						Layout:       testCase.layout,
+						ActionLock:   testActionLock(t),
+					},
+					testCase.repo,
+				),
+			)
+		})
+	}
+}
+
+// testActionLock locks every `uses` reference in the project types to a fake
+// commit SHA.
+func testActionLock(t *testing.T) projects.ActionLock {
+	t.Helper()
+	references, err := projects.UsesReferences(projectTypes, nil)
+	if err != nil {
+		t.Fatalf("Collecting 'uses' references: %v", err)
+	}
+	lock := make(projects.ActionLock, len(references))
+	for _, reference := range references {
+		lock[reference] = strings.Repeat("0", 40)
+	}
+	return lock
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+const (
+	formatText   = "text"
+	formatJSON   = "json"
+	formatGitHub = "github"
+)
+
+var (
+	outputFormat = flag.String(
+		"format",
+		formatText,
+		"output `format`: 'text' (human-readable), 'json' (one JSON record "+
+			"per line), or 'github' (GitHub Actions workflow commands, "+
+			"which annotate the offending files)",
+	)
+	logLevel = flag.String(
+		"log-level",
+		log.InfoLevel.String(),
+		"the `level` of log messages to print (e.g., 'debug', 'info', 'warn')",
+	)
+	verbose = flag.Bool("v", false, "print debug logs (same as -log-level=debug)")
+)
+
+// configureOutput validates the output flags and configures the logger
+// accordingly. Logs are written to stderr; in JSON mode they're JSON records
+// so that consumers needn't parse text.
+func configureOutput() error {
+	switch *outputFormat {
+	case formatText, formatGitHub:
+	case formatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf(
+			"invalid -format '%s': must be one of '%s', '%s', or '%s'",
+			*outputFormat,
+			formatText,
+			formatJSON,
+			formatGitHub,
+		)
+	}
+
+	level, err := log.ParseLevel(*logLevel)
+	if err != nil {
+		return fmt.Errorf("invalid -log-level: %w", err)
+	}
+	if *verbose {
+		level = log.DebugLevel
+	}
+	log.SetLevel(level)
+	return nil
+}
+
+// record is a single line of JSON output.
+type record struct {
+	Level string `json:"level"`
+	*projects.Error
+}
+
+func success(format string, v ...interface{}) {
+	if *outputFormat != formatText {
+		return
+	}
+	fmt.Printf("✅ "+format+"\n", v...)
+}
+
+func warning(format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	switch *outputFormat {
+	case formatJSON:
+		printRecord("warning", &projects.Error{
+			Kind:    projects.ErrorKindGeneric,
+			Message: message,
+		})
+	case formatGitHub:
+		fmt.Printf("::warning::%s\n", escapeData(message))
+	default:
+		color.Yellow("⚠️  %s\n", message)
+	}
+}
+
+// reportError prints `err` in the selected format. In the machine-readable
+// formats, each structured error (see `projects.Errors`) is printed
+// separately.
+func reportError(err error) {
+	if *outputFormat == formatText {
+		chunks := strings.Split(err.Error(), ": ")
+		indent := ""
+		for _, chunk := range chunks {
+			color.Red("%s↪️ ️%s\n", indent, chunk)
+			indent += "  "
+		}
+		return
+	}
+
+	for _, e := range projects.Errors(err) {
+		e = relativeError(e)
+		if *outputFormat == formatJSON {
+			printRecord("error", e)
+			continue
+		}
+		printAnnotation("error", e)
+	}
+}
+
+// reportWarning prints a structured warning (e.g., see
+// `projects.MissingVersions`) in the selected format.
+func reportWarning(e *projects.Error) {
+	e = relativeError(e)
+	switch *outputFormat {
+	case formatJSON:
+		printRecord("warning", e)
+	case formatGitHub:
+		printAnnotation("warning", e)
+	default:
+		message := e.Message
+		if e.File != "" {
+			message = e.File + ": " + message
+		}
+		color.Yellow("⚠️  %s\n", message)
+	}
+}
+
+// printAnnotation prints a structured error as a GitHub workflow command
+// (`error` or `warning`) which annotates its file.
+func printAnnotation(command string, e *projects.Error) {
+	var properties []string
+	if e.File != "" {
+		properties = append(properties, "file="+escapeProperty(e.File))
+	}
+	if e.Line > 0 {
+		properties = append(properties, fmt.Sprintf("line=%d", e.Line))
+	}
+	properties = append(properties, "title="+escapeProperty(string(e.Kind)))
+	fmt.Printf(
+		"::%s %s::%s\n",
+		command,
+		strings.Join(properties, ","),
+		escapeData(e.Message),
+	)
+}
+
+// printRecord prints `err` as a line of JSON. If it can't be encoded, the
+// failure and the original message are reported on stderr instead so that
+// stdout remains valid JSON lines.
+func printRecord(level string, err *projects.Error) {
+	data, jsonErr := json.Marshal(record{Level: level, Error: err})
+	if jsonErr != nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"Encoding %s record: %v (message: %s)\n",
+			level,
+			jsonErr,
+			err.Message,
+		)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// relativeError returns a copy of `err` whose file path, if absolute, is made
+// relative to the repository root so that editors and GitHub can resolve it.
+func relativeError(err *projects.Error) *projects.Error {
+	if !filepath.IsAbs(err.File) {
+		return err
+	}
+	cwd, cwdErr := os.Getwd()
+	if cwdErr != nil {
+		return err
+	}
+	repoRoot, rootErr := findRepoRoot(cwd)
+	if rootErr != nil {
+		return err
+	}
+	relPath, relErr := filepath.Rel(repoRoot, err.File)
+	if relErr != nil || strings.HasPrefix(relPath, "..") {
+		return err
+	}
+	copied := *err
+	copied.File = filepath.ToSlash(relPath)
+	return &copied
+}
+
+// escapeData escapes the message of a GitHub workflow command.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a property value of a GitHub workflow command.
+func escapeProperty(s string) string {
+	return strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+		":", "%3A",
+		",", "%2C",
+	).Replace(s)
+}
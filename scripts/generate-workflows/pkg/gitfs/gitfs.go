@@ -0,0 +1,285 @@
+// Package gitfs exposes the tree of a git commit as a read-only `io/fs.FS`.
+// Files are read straight out of the repository's object database with the
+// `git` command, so no checkout is required.
+package gitfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FS is a read-only file system over the tree of a single git commit. It
+// implements `fs.ReadDirFS` and `fs.ReadFileFS`.
+type FS struct {
+	repoDir string
+	commit  string
+	entries map[string]*entry
+}
+
+type entry struct {
+	name     string
+	mode     fs.FileMode
+	object   string
+	size     int64
+	children []string
+}
+
+// New resolves `rev` (a commit SHA, branch, tag, or any other revision
+// understood by `git rev-parse`) in the repository at `repoDir` and returns
+// a file system over the corresponding tree.
+func New(repoDir, rev string) (*FS, error) {
+	commit, err := Git(repoDir, "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("Resolving revision '%s': %w", rev, err)
+	}
+
+	fsys := &FS{
+		repoDir: repoDir,
+		commit:  strings.TrimSpace(string(commit)),
+		entries: map[string]*entry{
+			".": {name: ".", mode: fs.ModeDir | 0755},
+		},
+	}
+
+	listing, err := Git(
+		repoDir,
+		"ls-tree",
+		"-r",
+		"-t",
+		"-l",
+		"-z",
+		"--full-tree",
+		fsys.commit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Listing tree of '%s': %w", rev, err)
+	}
+
+	for _, record := range strings.Split(string(listing), "\x00") {
+		if record == "" {
+			continue
+		}
+		if err := fsys.addRecord(record); err != nil {
+			return nil, fmt.Errorf(
+				"Parsing tree of '%s': record '%s': %w",
+				rev,
+				record,
+				err,
+			)
+		}
+	}
+
+	// `ls-tree` lists parents before children, but sort anyway so that
+	// directory listings are in lexical order per the `fs.ReadDirFS`
+	// contract.
+	for _, e := range fsys.entries {
+		sort.Strings(e.children)
+	}
+
+	return fsys, nil
+}
+
+// Commit returns the SHA of the commit whose tree the file system exposes.
+func (fsys *FS) Commit() string {
+	return fsys.commit
+}
+
+// addRecord parses a single `git ls-tree -l` record of the form
+// `<mode> SP <type> SP <object> SP+ <size> TAB <path>` and adds it to the
+// file system.
+func (fsys *FS) addRecord(record string) error {
+	tab := strings.IndexByte(record, '\t')
+	if tab < 0 {
+		return fmt.Errorf("missing path")
+	}
+	fields := strings.Fields(record[:tab])
+	if len(fields) != 4 {
+		return fmt.Errorf("expected 4 fields; found %d", len(fields))
+	}
+	name := record[tab+1:]
+
+	e := &entry{name: path.Base(name), object: fields[2]}
+	switch fields[0] {
+	case "040000":
+		e.mode = fs.ModeDir | 0755
+	case "160000":
+		// Submodules are represented as empty directories since their
+		// contents aren't part of this repository's object database.
+		e.mode = fs.ModeDir | 0755
+	case "120000":
+		e.mode = fs.ModeSymlink | 0777
+	case "100755":
+		e.mode = 0755
+	case "100644":
+		e.mode = 0644
+	default:
+		return fmt.Errorf("unsupported mode '%s'", fields[0])
+	}
+	if fields[3] != "-" {
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return fmt.Errorf("parsing size: %w", err)
+		}
+		e.size = size
+	}
+
+	parent, found := fsys.entries[path.Dir(name)]
+	if !found {
+		return fmt.Errorf("parent directory not listed")
+	}
+	parent.children = append(parent.children, name)
+	fsys.entries[name] = e
+	return nil
+}
+
+func (fsys *FS) lookup(op, name string) (*entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, found := fsys.entries[name]
+	if !found {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+// Open implements the `fs.FS` interface.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	e, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &dir{info: fileInfo{e}, entries: entries}, nil
+	}
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{info: fileInfo{e}, Reader: bytes.NewReader(data)}, nil
+}
+
+// ReadFile implements the `fs.ReadFileFS` interface.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	e, err := fsys.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		return nil, &fs.PathError{
+			Op:   "read",
+			Path: name,
+			Err:  fmt.Errorf("is a directory"),
+		}
+	}
+	data, err := Git(fsys.repoDir, "cat-file", "blob", e.object)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// ReadDir implements the `fs.ReadDirFS` interface.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &fs.PathError{
+			Op:   "readdir",
+			Path: name,
+			Err:  fmt.Errorf("not a directory"),
+		}
+	}
+	entries := make([]fs.DirEntry, len(e.children))
+	for i, child := range e.children {
+		entries[i] = fileInfo{fsys.entries[child]}
+	}
+	return entries, nil
+}
+
+// fileInfo implements both `fs.FileInfo` and `fs.DirEntry`.
+type fileInfo struct{ e *entry }
+
+func (fi fileInfo) Name() string               { return fi.e.name }
+func (fi fileInfo) Size() int64                { return fi.e.size }
+func (fi fileInfo) Mode() fs.FileMode          { return fi.e.mode }
+func (fi fileInfo) Type() fs.FileMode          { return fi.e.mode.Type() }
+func (fi fileInfo) ModTime() time.Time         { return time.Time{} }
+func (fi fileInfo) IsDir() bool                { return fi.e.mode.IsDir() }
+func (fi fileInfo) Sys() interface{}           { return nil }
+func (fi fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+type file struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{
+		Op:   "read",
+		Path: d.info.e.name,
+		Err:  fmt.Errorf("is a directory"),
+	}
+}
+
+// ReadDir implements the `fs.ReadDirFile` interface.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) < 1 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
+
+// Git runs git with the provided arguments in the repository `repoDir` and
+// returns its standard output. If git fails, the error includes its standard
+// error.
+func Git(repoDir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"running git %s: %w: %s",
+			strings.Join(args, " "),
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+	return out, nil
+}
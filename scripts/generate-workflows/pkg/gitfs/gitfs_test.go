@@ -0,0 +1,133 @@
+package gitfs
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// newRepo creates a git repository in a temporary directory with a commit of
+// the provided files (keyed by slash-separated path) and returns its
+// directory.
+func newRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir, err := ioutil.TempDir("", "gitfs-test")
+	if err != nil {
+		t.Fatalf("Creating temporary directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, contents := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("Creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(
+			filePath,
+			[]byte(contents),
+			0644,
+		); err != nil {
+			t.Fatalf("Writing '%s': %v", name, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(
+			os.Environ(),
+			"GIT_AUTHOR_NAME=test",
+			"GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test",
+			"GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf(
+				"Running git %s: %v: %s",
+				strings.Join(args, " "),
+				err,
+				out,
+			)
+		}
+	}
+	return dir
+}
+
+func TestFS(t *testing.T) {
+	files := map[string]string{
+		"README.md":              "hello\n",
+		"apps/foo/main.go":       "package main\n",
+		"apps/foo/projects.yaml": "projects: []\n",
+		"dir with spaces/f.txt":  "spaces\n",
+		"empty":                  "",
+	}
+	dir := newRepo(t, files)
+
+	fsys, err := New(dir, "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	if err := fstest.TestFS(fsys, names...); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, wanted := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatalf("Reading '%s': %v", name, err)
+		}
+		if string(data) != wanted {
+			t.Errorf("'%s': wanted %q; found %q", name, wanted, data)
+		}
+	}
+
+	head, err := Git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit := strings.TrimSpace(string(head)); fsys.Commit() != commit {
+		t.Errorf("Commit: wanted %s; found %s", commit, fsys.Commit())
+	}
+}
+
+func TestFSErrors(t *testing.T) {
+	dir := newRepo(t, map[string]string{"a/b.txt": "b\n"})
+
+	if _, err := New(dir, "no-such-revision"); err == nil {
+		t.Fatal("Wanted an error for an unknown revision")
+	}
+
+	fsys, err := New(dir, "HEAD")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := fsys.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Opening a missing file: wanted ErrNotExist; found %v", err)
+	}
+	if _, err := fsys.Open("../a"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Opening an invalid path: wanted ErrInvalid; found %v", err)
+	}
+	if _, err := fsys.ReadFile("a"); err == nil {
+		t.Error("Wanted an error reading a directory")
+	}
+	if _, err := fsys.ReadDir("a/b.txt"); err == nil {
+		t.Error("Wanted an error listing a file")
+	}
+}
@@ -0,0 +1,275 @@
+package projects
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ActionLock maps `uses` references (e.g., `actions/checkout@v2`) to the full
+// commit SHAs to which they are pinned. Tags and branches are mutable, so
+// pinning to a SHA guarantees that a workflow always runs the same action
+// code.
+type ActionLock map[string]string
+
+// LoadActionLock parses an action lockfile. The lockfile is a YAML document
+// with a single `actions` mapping from `uses` references to commit SHAs:
+//
+//	actions:
+//	  actions/checkout@v2: <40-character commit SHA>
+func LoadActionLock(filePath string) (ActionLock, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Actions ActionLock `yaml:"actions"`
+	}
+	if err := yaml.Unmarshal(data, &payload); err != nil {
+		return nil, yamlError(ErrorKindActionLock, filePath, err)
+	}
+
+	for uses, sha := range payload.Actions {
+		if !commitSHAPattern.MatchString(sha) {
+			return nil, &Error{
+				Kind: ErrorKindActionLock,
+				File: filePath,
+				Message: fmt.Sprintf(
+					"lock entry for '%s': '%s' is not a full commit SHA",
+					uses,
+					sha,
+				),
+			}
+		}
+	}
+
+	if payload.Actions == nil {
+		return ActionLock{}, nil
+	}
+	return payload.Actions, nil
+}
+
+// UsesReferences returns the sorted, distinct pinnable `uses` references in
+// the provided project types (including their dependency types and
+// aggregates) and in the rendered static workflow files (keyed by file name).
+func UsesReferences(
+	types []ProjectType,
+	staticFiles map[string]string,
+) ([]string, error) {
+	references := map[string]struct{}{}
+	seen := map[*ProjectType]struct{}{}
+	var visit func(pt *ProjectType)
+	visit = func(pt *ProjectType) {
+		if _, ok := seen[pt]; ok {
+			return
+		}
+		seen[pt] = struct{}{}
+		for _, workflowTypes := range []WorkflowTypes{
+			pt.Workflows,
+			pt.Aggregates,
+		} {
+			for _, jobTypes := range workflowTypes {
+				for _, jobType := range jobTypes {
+					for _, step := range jobType.Steps {
+						if pinnable(step.Uses) {
+							references[step.Uses] = struct{}{}
+						}
+					}
+				}
+			}
+		}
+		for _, dependency := range pt.Dependencies {
+			visit(dependency)
+		}
+	}
+	for i := range types {
+		visit(&types[i])
+	}
+
+	for _, fileName := range sortedFileNames(staticFiles) {
+		uses, err := staticUses(staticFiles[fileName])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Reading 'uses' references of static file '%s': %w",
+				fileName,
+				err,
+			)
+		}
+		for _, reference := range uses {
+			if pinnable(reference) {
+				references[reference] = struct{}{}
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(references))
+	for reference := range references {
+		sorted = append(sorted, reference)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// Check returns an error listing every pinnable `uses` reference in the
+// provided project types and static workflow files (see `UsesReferences`)
+// which has no entry in the lock.
+func (lock ActionLock) Check(
+	types []ProjectType,
+	staticFiles map[string]string,
+) error {
+	references, err := UsesReferences(types, staticFiles)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, reference := range references {
+		if _, found := lock[reference]; !found {
+			missing = append(missing, reference)
+		}
+	}
+	if len(missing) > 0 {
+		return &Error{
+			Kind: ErrorKindActionLock,
+			Message: fmt.Sprintf(
+				"missing action lock entries for: %s",
+				strings.Join(missing, ", "),
+			),
+		}
+	}
+	return nil
+}
+
+// Pin rewrites the `uses` reference of every step in the workflows to the
+// locked commit SHA. The original tag or branch is preserved as a trailing
+// YAML comment. It returns an error if a pinnable reference has no lock entry.
+func (lock ActionLock) Pin(workflows []Workflow) error {
+	for i := range workflows {
+		for _, job := range workflows[i].Jobs {
+			// The steps slice is shared with the job type, so copy it
+			// before modifying.
+			steps := make([]JobStep, len(job.Steps))
+			for j, step := range job.Steps {
+				if pinnable(step.Uses) {
+					sha, found := lock[step.Uses]
+					if !found {
+						return &Error{
+							Kind:    ErrorKindActionLock,
+							Project: job.ProjectPath,
+							Message: fmt.Sprintf(
+								"pinning job '%s': missing action lock "+
+									"entry for '%s'",
+								job.Identifier,
+								step.Uses,
+							),
+						}
+					}
+					path, ref := splitUses(step.Uses)
+					step.pinnedRef = ref
+					step.Uses = path + "@" + sha
+				}
+				steps[j] = step
+			}
+			job.Steps = steps
+		}
+	}
+	return nil
+}
+
+// staticUsesPattern matches the `uses` key of a step (or a job which calls a
+// reusable workflow) in a static workflow file. The value may be quoted and
+// followed by a comment.
+var staticUsesPattern = regexp.MustCompile(
+	`(?m)^(\s*(?:-\s+)?uses:\s*)(['"]?)([^'"\s#]+)(['"]?)[ \t]*(?:#.*)?$`,
+)
+
+// staticUses returns the `uses` references in a static workflow file.
+func staticUses(contents string) ([]string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(contents), &document); err != nil {
+		return nil, err
+	}
+	var references []string
+	var visit func(node *yaml.Node)
+	visit = func(node *yaml.Node) {
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == "uses" &&
+					node.Content[i+1].Kind == yaml.ScalarNode {
+					references = append(references, node.Content[i+1].Value)
+				}
+			}
+		}
+		for _, child := range node.Content {
+			visit(child)
+		}
+	}
+	visit(&document)
+	return references, nil
+}
+
+// PinStaticFiles returns copies of the rendered static workflow files (keyed
+// by file name) whose `uses` references are rewritten to the locked commit
+// SHAs like `Pin` does. It returns an error if a pinnable reference has no
+// lock entry.
+func (lock ActionLock) PinStaticFiles(
+	staticFiles map[string]string,
+) (map[string]string, error) {
+	pinned := make(map[string]string, len(staticFiles))
+	for _, fileName := range sortedFileNames(staticFiles) {
+		var missing []string
+		pinned[fileName] = staticUsesPattern.ReplaceAllStringFunc(
+			staticFiles[fileName],
+			func(line string) string {
+				match := staticUsesPattern.FindStringSubmatch(line)
+				uses := match[3]
+				if !pinnable(uses) {
+					return line
+				}
+				sha, found := lock[uses]
+				if !found {
+					missing = append(missing, uses)
+					return line
+				}
+				actionPath, ref := splitUses(uses)
+				return match[1] + actionPath + "@" + sha + " # " + ref
+			},
+		)
+		if len(missing) > 0 {
+			return nil, &Error{
+				Kind: ErrorKindActionLock,
+				File: path.Join(".github/workflows", fileName),
+				Message: fmt.Sprintf(
+					"pinning static file: missing action lock entries "+
+						"for: %s",
+					strings.Join(missing, ", "),
+				),
+			}
+		}
+	}
+	return pinned, nil
+}
+
+// pinnable returns true if the `uses` reference points to a versioned action
+// in a repository. Local actions (`./path`) and docker images are left alone.
+func pinnable(uses string) bool {
+	return uses != "" &&
+		!strings.HasPrefix(uses, "./") &&
+		!strings.HasPrefix(uses, "docker://")
+}
+
+// splitUses splits a `uses` reference into the action path and the ref
+// (e.g., `actions/checkout@v2` becomes `actions/checkout` and `v2`).
+func splitUses(uses string) (string, string) {
+	if i := strings.LastIndex(uses, "@"); i >= 0 {
+		return uses[:i], uses[i+1:]
+	}
+	return uses, ""
+}
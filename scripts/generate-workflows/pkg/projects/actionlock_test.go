@@ -0,0 +1,93 @@
+package projects
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const staticWorkflow = `name: Static
+on: pull_request
+jobs:
+  check:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v2
+      - name: Setup
+        uses: "actions/setup-go@v2" # Go
+      - uses: ./local-action
+      - run: 'echo uses: nothing'
+`
+
+func TestUsesReferences(t *testing.T) {
+	projectType := ProjectType{
+		Identifier: "foo",
+		Workflows: WorkflowTypes{
+			WorkflowPullRequest: {{
+				Name:  "build",
+				Steps: []JobStep{{Uses: "actions/checkout@v2"}},
+			}},
+		},
+		Aggregates: WorkflowTypes{
+			WorkflowDrift: {{
+				Name:  "report",
+				Steps: []JobStep{{Uses: "actions/upload-artifact@v2"}},
+			}},
+		},
+	}
+	references, err := UsesReferences(
+		[]ProjectType{projectType},
+		map[string]string{"static.yaml": staticWorkflow},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wanted := []string{
+		"actions/checkout@v2",
+		"actions/setup-go@v2",
+		"actions/upload-artifact@v2",
+	}
+	if !reflect.DeepEqual(references, wanted) {
+		t.Fatalf("Wanted %v; found %v", wanted, references)
+	}
+}
+
+func TestActionLockCheck(t *testing.T) {
+	lock := ActionLock{"actions/checkout@v2": strings.Repeat("a", 40)}
+	err := lock.Check(nil, map[string]string{"static.yaml": staticWorkflow})
+	if err == nil {
+		t.Fatal("Wanted an error for the unlocked static reference")
+	}
+	if !strings.Contains(err.Error(), "actions/setup-go@v2") {
+		t.Fatalf("Wanted the error to name the missing entry: %v", err)
+	}
+}
+
+func TestPinStaticFiles(t *testing.T) {
+	checkout, setupGo := strings.Repeat("a", 40), strings.Repeat("b", 40)
+	lock := ActionLock{
+		"actions/checkout@v2": checkout,
+		"actions/setup-go@v2": setupGo,
+	}
+	pinned, err := lock.PinStaticFiles(
+		map[string]string{"static.yaml": staticWorkflow},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wanted := strings.NewReplacer(
+		"actions/checkout@v2",
+		"actions/checkout@"+checkout+" # v2",
+		`"actions/setup-go@v2" # Go`,
+		"actions/setup-go@"+setupGo+" # v2",
+	).Replace(staticWorkflow)
+	if pinned["static.yaml"] != wanted {
+		t.Fatalf("Wanted:\n%s\nFound:\n%s", wanted, pinned["static.yaml"])
+	}
+
+	if _, err := (ActionLock{}).PinStaticFiles(
+		map[string]string{"static.yaml": staticWorkflow},
+	); err == nil {
+		t.Fatal("Wanted an error for unlocked references")
+	}
+}
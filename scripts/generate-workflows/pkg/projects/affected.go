@@ -0,0 +1,78 @@
+package projects
+
+import (
+	"path"
+	"strings"
+)
+
+// AffectedProjects returns the projects which are affected by changes to the
+// provided repo-relative files: those whose directory or `Paths` contain a
+// changed file and those which depend (transitively, via
+// `Project.Dependencies` or `links`) on an affected project. The projects are
+// returned in their original order.
+func AffectedProjects(
+	projects []Project,
+	links []Link,
+	changedFiles []string,
+) []Project {
+	affected := make([]bool, len(projects))
+	for i := range projects {
+		paths := append([]string{projects[i].Path}, projects[i].Paths...)
+		for _, file := range changedFiles {
+			for _, p := range paths {
+				if contains(p, file) {
+					affected[i] = true
+				}
+			}
+		}
+	}
+
+	// Propagate to dependents until nothing changes. Project graphs are
+	// small, so this needn't be clever.
+	for changed := true; changed; {
+		changed = false
+		for i := range projects {
+			if affected[i] {
+				continue
+			}
+			var dependencies []ProjectIdentifier
+			for _, dependency := range projects[i].Dependencies {
+				dependencies = append(dependencies, dependency)
+			}
+			for _, link := range links {
+				if link.Dependent == projects[i].Path &&
+					link.Type == projects[i].Type.Identifier {
+					dependencies = append(dependencies, ProjectIdentifier{
+						Path: link.Dependency,
+						Type: projects[i].Type,
+					})
+				}
+			}
+			for _, dependency := range dependencies {
+				for j := range projects {
+					if affected[j] &&
+						projects[j].Path == dependency.Path &&
+						projects[j].Type.Identifier == dependency.Type.Identifier {
+						affected[i] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	var out []Project
+	for i := range projects {
+		if affected[i] {
+			out = append(out, projects[i])
+		}
+	}
+	return out
+}
+
+// contains reports whether the repo-relative `file` is within the directory
+// `dir`.
+func contains(dir, file string) bool {
+	dir, file = path.Clean(dir), path.Clean(file)
+	return dir == "." || file == dir || strings.HasPrefix(file, dir+"/")
+}
@@ -0,0 +1,119 @@
+package projects
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrorKind classifies an `Error`.
+type ErrorKind string
+
+const (
+	// ErrorKindGeneric is the kind of errors which carry no structured
+	// information (see `Errors`).
+	ErrorKindGeneric ErrorKind = "error"
+
+	// ErrorKindProjectFile is the kind of errors in a `projects.yaml` file
+	// (e.g., invalid YAML, an unknown project type, or a duplicate project).
+	ErrorKindProjectFile ErrorKind = "project-file"
+
+	// ErrorKindDependency is the kind of errors resolving a project's
+	// dependencies.
+	ErrorKindDependency ErrorKind = "dependency"
+
+	// ErrorKindLint is the kind of problems found by `Lint`.
+	ErrorKindLint ErrorKind = "lint"
+
+	// ErrorKindSecretsPolicy is the kind of violations found by
+	// `CheckSecretsPolicy`.
+	ErrorKindSecretsPolicy ErrorKind = "secrets-policy"
+
+	// ErrorKindActionLock is the kind of errors loading or applying the
+	// action lock.
+	ErrorKindActionLock ErrorKind = "action-lock"
+
+	// ErrorKindVersion is the kind of warnings found by `MissingVersions`.
+	ErrorKindVersion ErrorKind = "version"
+)
+
+// Error is an error which identifies the file and project responsible for it
+// so that it can be reported in machine-readable form (e.g., as a GitHub
+// annotation).
+type Error struct {
+	// Kind classifies the error.
+	Kind ErrorKind `json:"kind"`
+
+	// File is the path to the file responsible for the error, if any. It's
+	// repo-relative except for files outside of the repository (e.g., the
+	// action lock) whose paths are as they were provided.
+	File string `json:"file,omitempty"`
+
+	// Line is the 1-based line number within `File`, if known.
+	Line int `json:"line,omitempty"`
+
+	// Project is the repo-relative path of the project responsible for the
+	// error, if any.
+	Project string `json:"project,omitempty"`
+
+	// Message describes the error.
+	Message string `json:"message"`
+}
+
+// Error implements the `error` interface.
+func (err *Error) Error() string {
+	switch {
+	case err.File == "":
+		return err.Message
+	case err.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", err.File, err.Line, err.Message)
+	default:
+		return fmt.Sprintf("%s: %s", err.File, err.Message)
+	}
+}
+
+// ErrorList is an error made up of several `Error`s.
+type ErrorList []*Error
+
+// Error implements the `error` interface.
+func (errs ErrorList) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Errors extracts the structured errors from `err`'s chain. If there are
+// none, `err` is returned as a single error of kind `ErrorKindGeneric`.
+func Errors(err error) []*Error {
+	var lintErr LintError
+	if errors.As(err, &lintErr) {
+		return lintErr.Errors()
+	}
+	var list ErrorList
+	if errors.As(err, &list) {
+		return list
+	}
+	var structured *Error
+	if errors.As(err, &structured) {
+		return []*Error{structured}
+	}
+	return []*Error{{Kind: ErrorKindGeneric, Message: err.Error()}}
+}
+
+var yamlLinePattern = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// yamlError builds an `Error` from a YAML parse error, lifting the line
+// number out of the message.
+func yamlError(kind ErrorKind, file string, err error) *Error {
+	message := err.Error()
+	line := 0
+	if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+		line, _ = strconv.Atoi(match[1])
+		message = "yaml: " + message[len(match[0]):]
+	}
+	return &Error{Kind: kind, File: file, Line: line, Message: message}
+}
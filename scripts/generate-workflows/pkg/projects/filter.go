@@ -0,0 +1,133 @@
+package projects
+
+import (
+	"fmt"
+	"path"
+)
+
+// ProjectFilter selects projects by path and type. The zero value selects
+// every project.
+type ProjectFilter struct {
+	// Paths are `path.Match` patterns (e.g., `apps/*`) which are matched
+	// against project paths. If any are specified, a project must match at
+	// least one of them.
+	Paths []string
+
+	// Types are project type identifiers. If any are specified, a project's
+	// type must be one of them.
+	Types []string
+}
+
+// Validate returns an error if any of the path patterns is malformed.
+func (filter *ProjectFilter) Validate() error {
+	for _, pattern := range filter.Paths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid project pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Match reports whether the filter selects the project.
+func (filter *ProjectFilter) Match(p *Project) bool {
+	return filter.match(p.Path, p.Type.Identifier)
+}
+
+func (filter *ProjectFilter) match(projectPath, typeIdentifier string) bool {
+	if len(filter.Types) > 0 {
+		found := false
+		for _, t := range filter.Types {
+			if t == typeIdentifier {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.Paths) < 1 {
+		return true
+	}
+	for _, pattern := range filter.Paths {
+		// Patterns were checked by `Validate`, so errors are treated as
+		// mismatches.
+		if matched, _ := path.Match(pattern, projectPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterProjects returns the projects selected by the filter.
+func FilterProjects(projects []Project, filter *ProjectFilter) []Project {
+	var selected []Project
+	for i := range projects {
+		if filter.Match(&projects[i]) {
+			selected = append(selected, projects[i])
+		}
+	}
+	return selected
+}
+
+// FilterWorkflows returns the workflows restricted to the jobs of the projects
+// selected by the filter along with the jobs which they need (transitively),
+// since a job can't run without them. Workflows with no remaining jobs are
+// dropped.
+func FilterWorkflows(workflows []Workflow, filter *ProjectFilter) []Workflow {
+	var filtered []Workflow
+	for _, workflow := range workflows {
+		jobsByIdentifier := make(map[string]*Job, len(workflow.Jobs))
+		for _, job := range workflow.Jobs {
+			jobsByIdentifier[job.Identifier] = job
+		}
+
+		keep := map[string]struct{}{}
+		var visit func(job *Job)
+		visit = func(job *Job) {
+			if _, visited := keep[job.Identifier]; visited {
+				return
+			}
+			keep[job.Identifier] = struct{}{}
+			for _, dependency := range job.Dependencies {
+				if d, found := jobsByIdentifier[dependency]; found {
+					visit(d)
+				}
+			}
+		}
+		for _, job := range workflow.Jobs {
+			if !job.Aggregate &&
+				filter.match(job.ProjectPath, job.ProjectType.Identifier) {
+				visit(job)
+			}
+		}
+
+		// Aggregate jobs are kept if any of the jobs which they aggregate
+		// are, and only need those.
+		var jobs []*Job
+		for _, job := range workflow.Jobs {
+			if job.Aggregate {
+				var needs []string
+				for _, dependency := range job.Dependencies {
+					if _, found := keep[dependency]; found {
+						needs = append(needs, dependency)
+					}
+				}
+				if len(needs) > 0 {
+					job.Dependencies = needs
+					jobs = append(jobs, job)
+				}
+				continue
+			}
+			if _, found := keep[job.Identifier]; found {
+				jobs = append(jobs, job)
+			}
+		}
+		if len(jobs) > 0 {
+			workflow.Jobs = jobs
+			filtered = append(filtered, workflow)
+		}
+	}
+	return filtered
+}
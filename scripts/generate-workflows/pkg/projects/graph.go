@@ -0,0 +1,95 @@
+package projects
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DependencyGraph returns the dependency graph of the projects in Graphviz DOT
+// format. Each node is a project (labeled with its path and type) and each
+// edge points from a project to one of its dependencies, labeled with the
+// dependency's name. Links (see `Link`) among the projects are drawn as dashed
+// edges labeled with their reasons. Dependencies which aren't among `projects`
+// are included as well so that a filtered graph is complete.
+func DependencyGraph(projects []Project, links []Link) string {
+	type node struct {
+		path           string
+		typeIdentifier string
+	}
+	nodes := map[string]node{}
+	var edges []string
+	for i := range projects {
+		p := &projects[i]
+		nodes[p.Name()] = node{p.Path, p.Type.Identifier}
+
+		names := make([]string, 0, len(p.Dependencies))
+		for name := range p.Dependencies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			dependency := Project{
+				Type: p.Dependencies[name].Type,
+				Path: p.Dependencies[name].Path,
+			}
+			nodes[dependency.Name()] = node{
+				dependency.Path,
+				dependency.Type.Identifier,
+			}
+			edges = append(edges, fmt.Sprintf(
+				"  %q -> %q [label=%q];\n",
+				p.Name(),
+				dependency.Name(),
+				name,
+			))
+		}
+	}
+
+	// Links of several variants of the same projects (e.g., a contract
+	// which a target imports in each of its environments) are drawn once.
+	seen := map[string]struct{}{}
+	for _, link := range links {
+		linkType := &ProjectType{Identifier: link.Type}
+		dependent := Project{Type: linkType, Path: link.Dependent}
+		dependency := Project{Type: linkType, Path: link.Dependency}
+		_, dependentFound := nodes[dependent.Name()]
+		_, dependencyFound := nodes[dependency.Name()]
+		if !dependentFound || !dependencyFound {
+			continue
+		}
+		edge := fmt.Sprintf(
+			"  %q -> %q [label=%q, style=dashed];\n",
+			dependent.Name(),
+			dependency.Name(),
+			link.Reason,
+		)
+		if _, found := seen[edge]; !found {
+			seen[edge] = struct{}{}
+			edges = append(edges, edge)
+		}
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Strings(edges)
+
+	var sb strings.Builder
+	sb.WriteString("digraph projects {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, name := range names {
+		fmt.Fprintf(
+			&sb,
+			"  %q [label=%q];\n",
+			name,
+			fmt.Sprintf("%s\n(%s)", nodes[name].path, nodes[name].typeIdentifier),
+		)
+	}
+	for _, edge := range edges {
+		sb.WriteString(edge)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
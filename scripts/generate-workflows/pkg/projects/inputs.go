@@ -0,0 +1,171 @@
+package projects
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// Version identifies the generator's output format in the headers of rendered
+// files. Changes to the generator's logic are detected by the inputs hash via
+// `Config.Generator`, so it needn't be bumped for them.
+const Version = "0.1.0"
+
+// inputsHashPrefix precedes the inputs hash in rendered workflow file headers.
+const inputsHashPrefix = "# inputs: sha256:"
+
+// InputsHash returns a hex-encoded SHA-256 hash of everything that determines
+// the rendered files: the generator version and `Config.Generator`, the
+// configuration (including the project types), the static file templates, and every file read from the
+// repository during project discovery (including by `ProjectType.Links`).
+// Comparing it with the hash in the header of a rendered workflow file (see
+// `ReadInputsHash`) detects stale workflow files without rendering them, which
+// is what `generate-workflows check -quick` does.
+func InputsHash(config *Config, repo fs.FS) (string, error) {
+	_, _, repoFiles, err := discover(config, repo)
+	if err != nil {
+		return "", err
+	}
+	return inputsHash(config, repoFiles)
+}
+
+// InputFiles returns the sorted, repo-relative paths of the files which
+// project discovery reads from the repository (e.g., `projects.yaml` files and
+// the files read by `ProjectType.Links` and `ProjectType.Versions`). Changes
+// to them, to the configuration, or to the set of `projects.yaml` files may
+// change the rendered files.
+func InputFiles(config *Config, repo fs.FS) ([]string, error) {
+	_, _, repoFiles, err := discover(config, repo)
+	if err != nil {
+		return nil, err
+	}
+	filePaths := make([]string, 0, len(repoFiles))
+	for filePath := range repoFiles {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Strings(filePaths)
+	return filePaths, nil
+}
+
+// ReadInputsHash extracts the inputs hash from the header of a rendered
+// workflow file. It returns false if the file has no inputs hash.
+func ReadInputsHash(r io.Reader) (string, bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if strings.HasPrefix(line, inputsHashPrefix) {
+			return strings.TrimPrefix(line, inputsHashPrefix), true
+		}
+	}
+	return "", false
+}
+
+func inputsHash(config *Config, repoFiles map[string][]byte) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "version %s\n", Version)
+	fmt.Fprintf(h, "generator %s\n", config.Generator)
+
+	// The lock only changes the rendered files if actions are pinned;
+	// otherwise it's merely checked.
+	var lock ActionLock
+	if config.PinActions {
+		lock = config.ActionLock
+	}
+
+	// Pointers in the configuration (e.g., `ProjectType.Dependencies`) are
+	// followed, so the encoding depends only on values.
+	data, err := json.Marshal(struct {
+		ProjectTypes   []ProjectType
+		Branches       []string
+		Schedule       string
+		StaticSecrets  []string
+		StaticVersions map[string]string
+		Layout         Layout
+		Filter         ProjectFilter
+		ActionLock     ActionLock
+		PinActions     bool
+	}{
+		config.ProjectTypes,
+		config.Branches,
+		config.Schedule,
+		config.StaticSecrets,
+		config.StaticVersions,
+		config.Layout,
+		config.Filter,
+		lock,
+		config.PinActions,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Encoding config: %w", err)
+	}
+	fmt.Fprintf(h, "config %d\n", len(data))
+	h.Write(data)
+
+	if config.StaticFiles != nil {
+		if err := fs.WalkDir(
+			config.StaticFiles,
+			".",
+			func(filePath string, entry fs.DirEntry, err error) error {
+				if err != nil || entry.IsDir() {
+					return err
+				}
+				data, err := fs.ReadFile(config.StaticFiles, filePath)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(h, "static %s %d\n", filePath, len(data))
+				h.Write(data)
+				return nil
+			},
+		); err != nil {
+			return "", fmt.Errorf("Reading static files: %w", err)
+		}
+	}
+
+	filePaths := make([]string, 0, len(repoFiles))
+	for filePath := range repoFiles {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Strings(filePaths)
+	for _, filePath := range filePaths {
+		fmt.Fprintf(h, "repo %s %d\n", filePath, len(repoFiles[filePath]))
+		h.Write(repoFiles[filePath])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recordingFS wraps a file system and records the contents of every file read
+// with `fs.ReadFile`.
+type recordingFS struct {
+	fs.FS
+	files map[string][]byte
+}
+
+func newRecordingFS(fsys fs.FS) *recordingFS {
+	return &recordingFS{FS: fsys, files: map[string][]byte{}}
+}
+
+// ReadFile implements the `fs.ReadFileFS` interface.
+func (r *recordingFS) ReadFile(name string) ([]byte, error) {
+	data, err := fs.ReadFile(r.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	r.files[name] = append([]byte(nil), data...)
+	return data, nil
+}
+
+// ReadDir implements the `fs.ReadDirFS` interface.
+func (r *recordingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(r.FS, name)
+}
@@ -0,0 +1,25 @@
+package projects
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestInputsHashGenerator(t *testing.T) {
+	repo := fstest.MapFS{}
+	hash := func(generator string) string {
+		t.Helper()
+		h, err := InputsHash(&Config{Generator: generator}, repo)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return h
+	}
+	// Changes to the generator's logic change the hash.
+	if hash("a") == hash("b") {
+		t.Fatal("Wanted the hash to depend on the generator")
+	}
+	if hash("a") != hash("a") {
+		t.Fatal("Wanted the hash to be deterministic")
+	}
+}
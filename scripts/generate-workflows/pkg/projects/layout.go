@@ -0,0 +1,189 @@
+package projects
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Layout determines how jobs are distributed among workflow files.
+type Layout int
+
+const (
+	// LayoutWorkflow renders one file per workflow (e.g., all pull request
+	// jobs go into `pull-request.yaml`). It's the default.
+	LayoutWorkflow Layout = iota
+
+	// LayoutProject renders one file per workflow per project (e.g.,
+	// `pull-request-golang-foo.yaml`) so that the Actions UI shows a history
+	// per project.
+	LayoutProject
+
+	// LayoutProjectType renders one file per workflow per project type (e.g.,
+	// `pull-request-golang.yaml`).
+	LayoutProjectType
+)
+
+// ParseLayout parses the name of a layout (`workflow`, `project`, or
+// `project-type`).
+func ParseLayout(s string) (Layout, error) {
+	switch s {
+	case "workflow":
+		return LayoutWorkflow, nil
+	case "project":
+		return LayoutProject, nil
+	case "project-type":
+		return LayoutProjectType, nil
+	default:
+		return 0, fmt.Errorf(
+			"invalid layout '%s': must be one of 'workflow', 'project', or "+
+				"'project-type'",
+			s,
+		)
+	}
+}
+
+// String returns the name of the layout.
+func (layout Layout) String() string {
+	switch layout {
+	case LayoutWorkflow:
+		return "workflow"
+	case LayoutProject:
+		return "project"
+	case LayoutProjectType:
+		return "project-type"
+	default:
+		panic(fmt.Sprintf("Invalid Layout: %d", layout))
+	}
+}
+
+// groupKey returns the name of the file group to which the job belongs under
+// the layout.
+func (layout Layout) groupKey(job *Job) string {
+	switch layout {
+	case LayoutProject:
+		return job.ProjectName
+	case LayoutProjectType:
+		return job.ProjectType.Identifier
+	default:
+		return ""
+	}
+}
+
+// SplitWorkflows distributes the jobs of each workflow among files according
+// to the layout. Each resulting workflow is filtered to the paths of its
+// projects. Jobs which `needs` jobs in another group can't be split from
+// them (GitHub only resolves `needs` within a file), so such groups are kept
+// together in a shared file named after the group(s) which nothing else in
+// the file depends on.
+//
+// GitHub leaves the required status checks of a workflow which its path
+// filters skip pending forever, which would block every pull request that
+// doesn't touch every project. The jobs of the split workflows are therefore
+// never required (see `Job.Required`).
+func SplitWorkflows(workflows []Workflow, layout Layout) []Workflow {
+	if layout == LayoutWorkflow {
+		return workflows
+	}
+
+	var out []Workflow
+	for i := range workflows {
+		out = append(out, splitWorkflow(&workflows[i], layout)...)
+	}
+	return out
+}
+
+func splitWorkflow(workflow *Workflow, layout Layout) []Workflow {
+	jobsByIdentifier := make(map[string]*Job, len(workflow.Jobs))
+	for _, job := range workflow.Jobs {
+		jobsByIdentifier[job.Identifier] = job
+	}
+
+	// Union the groups of jobs which are linked by `needs`.
+	parents := map[string]string{}
+	var find func(key string) string
+	find = func(key string) string {
+		parent, found := parents[key]
+		if !found || parent == key {
+			parents[key] = key
+			return key
+		}
+		root := find(parent)
+		parents[key] = root
+		return root
+	}
+	dependedOn := map[string]struct{}{}
+	for _, job := range workflow.Jobs {
+		key := layout.groupKey(job)
+		find(key)
+		for _, dependency := range job.Dependencies {
+			if d, found := jobsByIdentifier[dependency]; found {
+				dependencyKey := layout.groupKey(d)
+				if dependencyKey != key {
+					dependedOn[dependencyKey] = struct{}{}
+				}
+				parents[find(dependencyKey)] = find(key)
+			}
+		}
+	}
+
+	// Name each component after its members which nothing else depends on.
+	members := map[string][]string{}
+	for key := range parents {
+		root := find(key)
+		members[root] = append(members[root], key)
+	}
+	names := make(map[string]string, len(members))
+	for root, keys := range members {
+		sort.Strings(keys)
+		var tops []string
+		for _, key := range keys {
+			if _, found := dependedOn[key]; !found {
+				tops = append(tops, key)
+			}
+		}
+		if len(tops) < 1 {
+			tops = keys
+		}
+		names[root] = strings.Join(tops, "+")
+	}
+
+	var out []Workflow
+	indices := map[string]int{}
+	for _, job := range workflow.Jobs {
+		name := names[find(layout.groupKey(job))]
+		i, found := indices[name]
+		if !found {
+			i = len(out)
+			indices[name] = i
+			out = append(out, Workflow{
+				Identifier: workflow.Identifier,
+				Suffix:     name,
+				Branches:   workflow.Branches,
+				Schedule:   workflow.Schedule,
+				InputsHash: workflow.InputsHash,
+			})
+		}
+		out[i].Jobs = append(out[i].Jobs, job)
+	}
+
+	for i := range out {
+		paths := map[string]struct{}{
+			path.Join(".github/workflows", out[i].FileName()): {},
+		}
+		for _, job := range out[i].Jobs {
+			for _, p := range job.ProjectPaths {
+				paths[path.Join(p, "**")] = struct{}{}
+			}
+			job.Required = false
+		}
+		for p := range paths {
+			out[i].Paths = append(out[i].Paths, p)
+		}
+		sort.Strings(out[i].Paths)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Suffix < out[j].Suffix })
+	return out
+}
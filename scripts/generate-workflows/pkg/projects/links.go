@@ -0,0 +1,137 @@
+package projects
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// Link is a dependency between two projects of the same type which is derived
+// from their contents (see `ProjectType.Links`) rather than declared in
+// `projects.yaml`.
+type Link struct {
+	// Dependent is the path of the project which depends on `Dependency`.
+	Dependent string
+
+	// Dependency is the path of the project on which `Dependent` depends.
+	Dependency string
+
+	// DependentVariant and DependencyVariant, if set, restrict the link to
+	// the projects' jobs of those variants (e.g., the environment in which a
+	// Terraform target imports a contract and the environment of the target
+	// which exports it). Jobs without a variant are always linked.
+	DependentVariant  string
+	DependencyVariant string
+
+	// Type is the identifier of the projects' type.
+	Type string
+
+	// Reason describes why the projects are linked (e.g., "imports contract
+	// prd/lambda-support").
+	Reason string
+}
+
+// FindLinks calls the `Links` function of each project type which has one
+// with the projects of that type.
+func FindLinks(types []ProjectType, repo fs.FS, projects []Project) ([]Link, error) {
+	var links []Link
+	for i := range types {
+		if types[i].Links == nil {
+			continue
+		}
+		var ofType []*Project
+		for j := range projects {
+			if projects[j].Type.Identifier == types[i].Identifier {
+				ofType = append(ofType, &projects[j])
+			}
+		}
+		typeLinks, err := types[i].Links(repo, ofType)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Linking projects of type '%s': %w",
+				types[i].Identifier,
+				err,
+			)
+		}
+		for _, link := range typeLinks {
+			link.Type = types[i].Identifier
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Dependent != links[j].Dependent {
+			return links[i].Dependent < links[j].Dependent
+		}
+		if links[i].Dependency != links[j].Dependency {
+			return links[i].Dependency < links[j].Dependency
+		}
+		if links[i].DependentVariant != links[j].DependentVariant {
+			return links[i].DependentVariant < links[j].DependentVariant
+		}
+		return links[i].DependencyVariant < links[j].DependencyVariant
+	})
+	return links, nil
+}
+
+// LinkWorkflows adds `needs` from every job of each link's dependent project
+// to every job of its dependency in the same workflow, subject to the link's
+// variants. Links without variants only relate variants of the same name
+// (e.g., environments) to each other. Jobs of scheduled
+// workflows (e.g., drift detection) only observe the projects, so they're
+// independent of each other.
+func LinkWorkflows(workflows []Workflow, links []Link) {
+	for i := range workflows {
+		if workflows[i].Identifier.Trigger() == "schedule" {
+			continue
+		}
+		for _, link := range links {
+			var dependencies []*Job
+			for _, job := range workflows[i].Jobs {
+				if job.ProjectPath == link.Dependency &&
+					job.ProjectType.Identifier == link.Type &&
+					matchesVariant(job, link.DependencyVariant) {
+					dependencies = append(dependencies, job)
+				}
+			}
+			for _, job := range workflows[i].Jobs {
+				if job.ProjectPath != link.Dependent ||
+					job.ProjectType.Identifier != link.Type ||
+					!matchesVariant(job, link.DependentVariant) {
+					continue
+				}
+				// `Dependencies` may be shared with other jobs, so copy it
+				// before appending.
+				needs := append([]string(nil), job.Dependencies...)
+				for _, dependency := range dependencies {
+					// Variants of the same name (e.g., environments) only
+					// need each other.
+					if link.DependentVariant == "" &&
+						link.DependencyVariant == "" &&
+						job.Variant != "" && dependency.Variant != "" &&
+						job.Variant != dependency.Variant {
+						continue
+					}
+					if !containsString(needs, dependency.Identifier) {
+						needs = append(needs, dependency.Identifier)
+					}
+				}
+				job.Dependencies = needs
+			}
+		}
+	}
+}
+
+// matchesVariant returns true if the job is of the variant, the variant is
+// unset, or the job has no variant.
+func matchesVariant(job *Job, variant string) bool {
+	return variant == "" || job.Variant == "" || job.Variant == variant
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,316 @@
+package projects
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var jobIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// unrenderedTemplatePattern matches Go template delimiters which survived
+// rendering. GitHub Actions expressions (`${{ ... }}`) are excluded.
+var unrenderedTemplatePattern = regexp.MustCompile(`(^|[^$])\{\{`)
+
+// LintProblem describes a single problem found by `Lint`.
+type LintProblem struct {
+	// Workflow is the name of the workflow file in which the problem was
+	// found.
+	Workflow string
+
+	// Job is the identifier of the offending job. It's empty for problems
+	// which don't pertain to a single job.
+	Job string
+
+	// ProjectPath is the repo-relative path of the project from which the
+	// offending job was materialized.
+	ProjectPath string
+
+	// ProjectType is the identifier of the offending job's project type.
+	ProjectType string
+
+	// JobType is the name of the job type from which the offending job was
+	// materialized.
+	JobType string
+
+	// Message describes the problem.
+	Message string
+}
+
+// String returns a human-readable description of the problem and its source.
+func (p LintProblem) String() string {
+	if p.Job == "" {
+		return fmt.Sprintf("%s: %s", p.Workflow, p.Message)
+	}
+	return fmt.Sprintf(
+		"%s: job '%s' (project path=%s, type=%s, job type=%s): %s",
+		p.Workflow,
+		p.Job,
+		p.ProjectPath,
+		p.ProjectType,
+		p.JobType,
+		p.Message,
+	)
+}
+
+// LintError is the error returned by `Lint`. It holds every problem found.
+type LintError []LintProblem
+
+// Error implements the `error` interface.
+func (err LintError) Error() string {
+	problems := make([]string, len(err))
+	for i, problem := range err {
+		problems[i] = problem.String()
+	}
+	return fmt.Sprintf(
+		"found %d problem(s); %s",
+		len(err),
+		strings.Join(problems, "; "),
+	)
+}
+
+// Errors converts the problems into structured errors. Problems with a job
+// are attributed to the `projects.yaml` file of the job's project; others are
+// attributed to the offending file in the workflows directory.
+func (err LintError) Errors() []*Error {
+	errs := make([]*Error, len(err))
+	for i, problem := range err {
+		errs[i] = &Error{Kind: ErrorKindLint, Message: problem.String()}
+		if problem.ProjectPath != "" {
+			errs[i].File = path.Join(problem.ProjectPath, KeyFileName)
+			errs[i].Project = problem.ProjectPath
+		} else {
+			errs[i].File = path.Join(".github/workflows", problem.Workflow)
+		}
+	}
+	return errs
+}
+
+// Lint validates the materialized workflows and returns a `LintError` listing
+// every problem found. Static files (keyed by file name) are checked for file
+// name collisions with the generated files.
+func Lint(workflows []Workflow, staticFiles map[string]string) error {
+	var problems LintError
+
+	fileNames := map[string]string{
+		ChecksManifestFileName:   "the checks manifest",
+		SecretsInventoryFileName: "the secrets inventory",
+	}
+	staticFileNames := make([]string, 0, len(staticFiles))
+	for fileName := range staticFiles {
+		staticFileNames = append(staticFileNames, fileName)
+	}
+	sort.Strings(staticFileNames)
+	for _, fileName := range staticFileNames {
+		if owner, exists := fileNames[fileName]; exists {
+			problems = append(problems, LintProblem{
+				Workflow: fileName,
+				Message: fmt.Sprintf(
+					"static file name collides with %s",
+					owner,
+				),
+			})
+			continue
+		}
+		fileNames[fileName] = "a static file"
+	}
+
+	for i := range workflows {
+		fileName := workflows[i].FileName()
+		if owner, exists := fileNames[fileName]; exists {
+			problems = append(problems, LintProblem{
+				Workflow: fileName,
+				Message: fmt.Sprintf(
+					"workflow '%s' file name collides with %s",
+					workflows[i].Name(),
+					owner,
+				),
+			})
+		}
+		fileNames[fileName] = fmt.Sprintf("workflow '%s'", workflows[i].Name())
+		problems = append(problems, lintWorkflow(&workflows[i])...)
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func lintWorkflow(workflow *Workflow) []LintProblem {
+	var problems []LintProblem
+	fileName := workflow.FileName()
+
+	jobIdentifiers := make(map[string]int, len(workflow.Jobs))
+	for _, job := range workflow.Jobs {
+		jobIdentifiers[job.Identifier]++
+	}
+	reportedDuplicates := map[string]struct{}{}
+
+	for _, job := range workflow.Jobs {
+		problem := func(format string, v ...interface{}) {
+			problems = append(problems, LintProblem{
+				Workflow:    fileName,
+				Job:         job.Identifier,
+				ProjectPath: job.ProjectPath,
+				ProjectType: job.ProjectType.Identifier,
+				JobType:     job.JobType,
+				Message:     fmt.Sprintf(format, v...),
+			})
+		}
+
+		// Each duplicate identifier is reported once, attributed to its
+		// first job.
+		if n := jobIdentifiers[job.Identifier]; n > 1 {
+			if _, found := reportedDuplicates[job.Identifier]; !found {
+				reportedDuplicates[job.Identifier] = struct{}{}
+				problem("duplicate job identifier (%d jobs)", n)
+			}
+		}
+
+		if !jobIdentifierPattern.MatchString(job.Identifier) {
+			problem(
+				"invalid job identifier: identifiers must start with a " +
+					"letter or '_' and contain only alphanumeric " +
+					"characters, '-', or '_'",
+			)
+		}
+
+		for _, dependency := range job.Dependencies {
+			if _, found := jobIdentifiers[dependency]; !found {
+				problem("needs job '%s' which isn't in the workflow", dependency)
+			}
+		}
+
+		if len(job.Steps) < 1 {
+			problem("job has no steps")
+		}
+
+		steps, err := job.RenderSteps()
+		if err != nil {
+			problem("%v", err)
+			continue
+		}
+
+		stepIDs := map[string]struct{}{}
+		for i, step := range steps {
+			stepName := step.Name
+			if stepName == "" {
+				stepName = fmt.Sprintf("#%d", i)
+			}
+
+			if step.ID != "" {
+				if !jobIdentifierPattern.MatchString(step.ID) {
+					problem("invalid step id '%s'", step.ID)
+				}
+				if _, found := stepIDs[step.ID]; found {
+					problem("duplicate step id '%s'", step.ID)
+				}
+				stepIDs[step.ID] = struct{}{}
+			}
+
+			if step.Run != "" && step.Uses != "" {
+				problem("step '%s' has both 'run' and 'uses'", stepName)
+			}
+			if step.Run == "" && step.Uses == "" {
+				problem("step '%s' has neither 'run' nor 'uses'", stepName)
+			}
+			if len(step.With) > 0 && step.Uses == "" {
+				problem("step '%s' has 'with' but no 'uses'", stepName)
+			}
+
+			fields := map[string]string{
+				"name": step.Name,
+				"run":  step.Run,
+				"uses": step.Uses,
+			}
+			for key, value := range step.Env {
+				fields["env."+key] = value
+			}
+			for key, value := range step.With {
+				fields["with."+key] = value
+			}
+			keys := make([]string, 0, len(fields))
+			for key := range fields {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if unrenderedTemplatePattern.MatchString(fields[key]) {
+					problem(
+						"step '%s' field '%s' contains unrendered template "+
+							"delimiters ('{{')",
+						stepName,
+						key,
+					)
+				}
+			}
+		}
+	}
+
+	problems = append(problems, lintCycles(workflow)...)
+	return problems
+}
+
+// lintCycles reports each cycle of `needs` in the workflow once, attributed
+// to the job at which it was detected.
+func lintCycles(workflow *Workflow) []LintProblem {
+	jobsByIdentifier := make(map[string]*Job, len(workflow.Jobs))
+	for _, job := range workflow.Jobs {
+		jobsByIdentifier[job.Identifier] = job
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[string]int, len(workflow.Jobs))
+	var problems []LintProblem
+	var stack []string
+	var visit func(job *Job)
+	visit = func(job *Job) {
+		states[job.Identifier] = visiting
+		stack = append(stack, job.Identifier)
+		for _, dependency := range job.Dependencies {
+			d, found := jobsByIdentifier[dependency]
+			if !found {
+				continue
+			}
+			switch states[dependency] {
+			case unvisited:
+				visit(d)
+			case visiting:
+				start := len(stack) - 1
+				for stack[start] != dependency {
+					start--
+				}
+				cycle := append(
+					append([]string(nil), stack[start:]...),
+					dependency,
+				)
+				problems = append(problems, LintProblem{
+					Workflow:    workflow.FileName(),
+					Job:         job.Identifier,
+					ProjectPath: job.ProjectPath,
+					ProjectType: job.ProjectType.Identifier,
+					JobType:     job.JobType,
+					Message: fmt.Sprintf(
+						"cyclic 'needs': %s",
+						strings.Join(cycle, " -> "),
+					),
+				})
+			}
+		}
+		stack = stack[:len(stack)-1]
+		states[job.Identifier] = visited
+	}
+	for _, job := range workflow.Jobs {
+		if states[job.Identifier] == unvisited {
+			visit(job)
+		}
+	}
+	return problems
+}
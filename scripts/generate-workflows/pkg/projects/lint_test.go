@@ -0,0 +1,164 @@
+package projects
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	projectType := ProjectType{Identifier: "foo"}
+	job := func(identifier string, steps []JobStep, needs ...string) *Job {
+		return &Job{
+			Identifier:   identifier,
+			ProjectPath:  "bar",
+			ProjectType:  &projectType,
+			JobType:      "build",
+			Dependencies: needs,
+			Steps:        steps,
+		}
+	}
+	run := []JobStep{{Run: "true"}}
+
+	for _, testCase := range []struct {
+		name        string
+		jobs        []*Job
+		staticFiles map[string]string
+		problems    []string
+	}{
+		{
+			name: "valid",
+			jobs: []*Job{job("a", run), job("b", run, "a")},
+		},
+		{
+			name:     "duplicate job identifier",
+			jobs:     []*Job{job("a", run), job("a", run), job("a", run)},
+			problems: []string{"duplicate job identifier (3 jobs)"},
+		},
+		{
+			name:     "invalid job identifier",
+			jobs:     []*Job{job("a.b", run)},
+			problems: []string{"invalid job identifier"},
+		},
+		{
+			name:     "missing need",
+			jobs:     []*Job{job("a", run, "b")},
+			problems: []string{"needs job 'b' which isn't in the workflow"},
+		},
+		{
+			name:     "no steps",
+			jobs:     []*Job{job("a", nil)},
+			problems: []string{"job has no steps"},
+		},
+		{
+			name: "run and uses",
+			jobs: []*Job{job("a", []JobStep{{
+				Name: "both",
+				Run:  "true",
+				Uses: "actions/checkout@v2",
+			}})},
+			problems: []string{"step 'both' has both 'run' and 'uses'"},
+		},
+		{
+			name:     "neither run nor uses",
+			jobs:     []*Job{job("a", []JobStep{{}})},
+			problems: []string{"step '#0' has neither 'run' nor 'uses'"},
+		},
+		{
+			name: "with without uses",
+			jobs: []*Job{job("a", []JobStep{{
+				Run:  "true",
+				With: map[string]string{"foo": "bar"},
+			}})},
+			problems: []string{"step '#0' has 'with' but no 'uses'"},
+		},
+		{
+			name: "invalid and duplicate step ids",
+			jobs: []*Job{job("a", []JobStep{
+				{ID: "x.y", Run: "true"},
+				{ID: "z", Run: "true"},
+				{ID: "z", Run: "true"},
+			})},
+			problems: []string{
+				"invalid step id 'x.y'",
+				"duplicate step id 'z'",
+			},
+		},
+		{
+			name: "unrendered template delimiters",
+			jobs: []*Job{job("a", []JobStep{{
+				Run: "echo {{`{{ .Oops }}`}} ${{ github.sha }}",
+			}})},
+			problems: []string{
+				"field 'run' contains unrendered template delimiters",
+			},
+		},
+		{
+			name: "invalid template",
+			jobs: []*Job{job("a", []JobStep{{
+				Name: "broken",
+				Run:  "{{ .Path",
+			}})},
+			problems: []string{"Rendering 'run' template of step 'broken'"},
+		},
+		{
+			name: "cycle",
+			jobs: []*Job{
+				job("a", run, "b"),
+				job("b", run, "c"),
+				job("c", run, "a"),
+			},
+			problems: []string{"cyclic 'needs': a -> b -> c -> a"},
+		},
+		{
+			name: "static file collides with the checks manifest",
+			jobs: []*Job{job("a", run)},
+			staticFiles: map[string]string{
+				ChecksManifestFileName: "{}",
+			},
+			problems: []string{
+				"static file name collides with the checks manifest",
+			},
+		},
+		{
+			name: "workflow collides with a static file",
+			jobs: []*Job{job("a", run)},
+			staticFiles: map[string]string{
+				WorkflowPullRequest.FileName(): "",
+			},
+			problems: []string{"file name collides with a static file"},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := Lint(
+				[]Workflow{{
+					Identifier: WorkflowPullRequest,
+					Jobs:       testCase.jobs,
+				}},
+				testCase.staticFiles,
+			)
+			var problems LintError
+			if err != nil && !errors.As(err, &problems) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(problems) != len(testCase.problems) {
+				t.Fatalf(
+					"Wanted %d problem(s); found %d: %v",
+					len(testCase.problems),
+					len(problems),
+					err,
+				)
+			}
+			for i, wanted := range testCase.problems {
+				if !strings.Contains(problems[i].Message, wanted) {
+					t.Errorf(
+						"Problem %d: wanted '%s'; found '%s'",
+						i,
+						wanted,
+						problems[i].Message,
+					)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package projects
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChecksManifestFileName is the name of the checks manifest file which is
+// rendered alongside the workflow files.
+const ChecksManifestFileName = "checks.json"
+
+// ChecksManifest is a machine-readable description of every job in the
+// rendered workflow files. It's intended to be consumed by scripts which keep
+// the repository's branch protection settings in sync with the generated
+// workflows rather than configuring required checks by hand.
+type ChecksManifest struct {
+	// Workflows describes each workflow file and the jobs therein.
+	Workflows []ManifestWorkflow `json:"workflows"`
+
+	// RequiredChecks is the sorted list of status check names which must pass
+	// before a pull request may be merged. It's suitable for the
+	// `required_status_checks.contexts` field of the GitHub branch protection
+	// API.
+	RequiredChecks []string `json:"required_checks"`
+}
+
+// ManifestWorkflow describes a single workflow file in the checks manifest.
+type ManifestWorkflow struct {
+	// File is the name of the workflow file within the workflows directory.
+	File string `json:"file"`
+
+	// Name is the workflow's `name`.
+	Name string `json:"name"`
+
+	// Triggers are the events which trigger the workflow (e.g.,
+	// `pull_request`).
+	Triggers []string `json:"triggers"`
+
+	// Jobs describes the jobs in the workflow in the order they appear in the
+	// workflow file.
+	Jobs []ManifestJob `json:"jobs"`
+}
+
+// ManifestJob describes a single job in the checks manifest.
+type ManifestJob struct {
+	// Identifier is the job's key within the workflow's `jobs` mapping.
+	Identifier string `json:"identifier"`
+
+	// Check is the name of the status check that GitHub reports for the job.
+	Check string `json:"check"`
+
+	// Project is the project to which the job belongs. It's nil for jobs in
+	// static workflow files.
+	Project *ManifestProject `json:"project,omitempty"`
+
+	// Required indicates whether the job's check should be required for
+	// merging pull requests.
+	Required bool `json:"required"`
+}
+
+// ManifestProject identifies a project in the checks manifest.
+type ManifestProject struct {
+	// Name is the project name (see `Project.Name()`).
+	Name string `json:"name"`
+
+	// Path is the repo-relative path to the project directory.
+	Path string `json:"path"`
+
+	// Type is the project type identifier.
+	Type string `json:"type"`
+}
+
+// BuildChecksManifest builds a checks manifest from the materialized
+// workflows and the static workflow files (keyed by file name).
+func BuildChecksManifest(
+	workflows []Workflow,
+	staticFiles map[string]string,
+) (*ChecksManifest, error) {
+	var manifest ChecksManifest
+	for i := range workflows {
+		workflow := &workflows[i]
+		mw := ManifestWorkflow{
+			File:     workflow.FileName(),
+			Name:     workflow.Name(),
+			Triggers: workflow.Identifier.Triggers(),
+			Jobs:     make([]ManifestJob, len(workflow.Jobs)),
+		}
+		for j, job := range workflow.Jobs {
+			mw.Jobs[j] = ManifestJob{
+				Identifier: job.Identifier,
+				Check:      job.Identifier,
+				Project: &ManifestProject{
+					Name: job.ProjectName,
+					Path: job.ProjectPath,
+					Type: job.ProjectType.Identifier,
+				},
+				Required: job.Required,
+			}
+		}
+		manifest.Workflows = append(manifest.Workflows, mw)
+	}
+
+	fileNames := make([]string, 0, len(staticFiles))
+	for fileName := range staticFiles {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		mw, err := parseStaticWorkflow(fileName, staticFiles[fileName])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Parsing static workflow file '%s': %w",
+				fileName,
+				err,
+			)
+		}
+		manifest.Workflows = append(manifest.Workflows, mw)
+	}
+
+	manifest.RequiredChecks = []string{}
+	for _, workflow := range manifest.Workflows {
+		for _, job := range workflow.Jobs {
+			if job.Required {
+				manifest.RequiredChecks = append(
+					manifest.RequiredChecks,
+					job.Check,
+				)
+			}
+		}
+	}
+	sort.Strings(manifest.RequiredChecks)
+
+	return &manifest, nil
+}
+
+// parseStaticWorkflow extracts the manifest information from a hand-written
+// workflow file. Every job in a workflow that is triggered by pull requests is
+// considered required.
+func parseStaticWorkflow(fileName, contents string) (ManifestWorkflow, error) {
+	var payload struct {
+		Name string    `yaml:"name"`
+		On   yaml.Node `yaml:"on"`
+		Jobs yaml.Node `yaml:"jobs"`
+	}
+	if err := yaml.Unmarshal([]byte(contents), &payload); err != nil {
+		return ManifestWorkflow{}, err
+	}
+
+	// `on` may be a single event name, a list of event names, or a mapping
+	// of event names to their configuration.
+	var triggers []string
+	switch payload.On.Kind {
+	case yaml.ScalarNode:
+		triggers = []string{payload.On.Value}
+	case yaml.SequenceNode:
+		for _, node := range payload.On.Content {
+			triggers = append(triggers, node.Value)
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(payload.On.Content); i += 2 {
+			triggers = append(triggers, payload.On.Content[i].Value)
+		}
+	default:
+		return ManifestWorkflow{}, fmt.Errorf("missing or invalid 'on' field")
+	}
+
+	required := false
+	for _, trigger := range triggers {
+		if trigger == "pull_request" || trigger == "pull_request_target" {
+			required = true
+		}
+	}
+
+	if payload.Jobs.Kind != yaml.MappingNode {
+		return ManifestWorkflow{}, fmt.Errorf("missing or invalid 'jobs' field")
+	}
+	mw := ManifestWorkflow{
+		File:     fileName,
+		Name:     payload.Name,
+		Triggers: triggers,
+		Jobs:     make([]ManifestJob, 0, len(payload.Jobs.Content)/2),
+	}
+	for i := 0; i < len(payload.Jobs.Content); i += 2 {
+		identifier := payload.Jobs.Content[i].Value
+		var job struct {
+			Name string `yaml:"name"`
+		}
+		if err := payload.Jobs.Content[i+1].Decode(&job); err != nil {
+			return ManifestWorkflow{}, fmt.Errorf(
+				"decoding job '%s': %w",
+				identifier,
+				err,
+			)
+		}
+		check := identifier
+		if job.Name != "" {
+			check = job.Name
+		}
+		mw.Jobs = append(mw.Jobs, ManifestJob{
+			Identifier: identifier,
+			Check:      check,
+			Required:   required,
+		})
+	}
+	return mw, nil
+}
+
+// RenderChecksManifest writes the checks manifest as JSON into the provided
+// sink.
+func RenderChecksManifest(sink Sink, manifest *ChecksManifest) error {
+	return renderJSON(sink, ChecksManifestFileName, manifest)
+}
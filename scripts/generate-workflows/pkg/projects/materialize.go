@@ -2,6 +2,7 @@ package projects
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -15,33 +16,107 @@ type Workflow struct {
 
 	// Jobs are the list of jobs to execute as part of the workflow
 	Jobs []*Job
+
+	// Branches are the branches whose pull requests or pushes trigger the
+	// workflow.
+	Branches []string
+
+	// InputsHash is the hash of the generator's inputs (see `InputsHash`). It's
+	// rendered into the file header along with the generator `Version`.
+	InputsHash string
+
+	// Suffix distinguishes workflow files of the same workflow identifier
+	// when a `Layout` splits a workflow among several files. It's empty for
+	// the default layout.
+	Suffix string
+
+	// Paths are path filters; if any are specified, the workflow is only
+	// triggered by changes to matching files.
+	Paths []string
+
+	// Schedule is the cron schedule of a scheduled workflow (see
+	// `WorkflowIdentifier.Trigger`).
+	Schedule string
+}
+
+// Name returns the human-readable name of the workflow.
+func (w *Workflow) Name() string {
+	if w.Suffix == "" {
+		return w.Identifier.String()
+	}
+	return fmt.Sprintf("%s (%s)", w.Identifier.String(), w.Suffix)
+}
+
+// FileName returns the name of the workflow file.
+func (w *Workflow) FileName() string {
+	if w.Suffix == "" {
+		return w.Identifier.FileName()
+	}
+	return fmt.Sprintf(
+		"%s-%s.yaml",
+		strings.TrimSuffix(w.Identifier.FileName(), ".yaml"),
+		w.Suffix,
+	)
 }
 
 // MarshalYAML marshals a workflow into valid GitHub Actions Workflow YAML.
 func (w *Workflow) MarshalYAML() (interface{}, error) {
 	jobMap := make([]field, len(w.Jobs))
 	for i, job := range w.Jobs {
-		node := &yaml.Node{}
-		if err := node.Encode(job); err != nil {
+		node, err := job.node()
+		if err != nil {
 			return nil, fmt.Errorf("yaml-encoding job '%s': %w", job.Identifier, err)
 		}
 		jobMap[i] = field{job.Identifier, node}
 	}
+	jobs := mapping(jobMap...)
+	for i, job := range w.Jobs {
+		jobs.Content[2*i].HeadComment = job.provenance()
+	}
+
+	branches := make([]*yaml.Node, len(w.Branches))
+	for i, branch := range w.Branches {
+		branches[i] = scalar(branch)
+	}
+	filters := []field{{"branches", list(branches...)}}
+	if len(w.Paths) > 0 {
+		paths := make([]*yaml.Node, len(w.Paths))
+		for i, p := range w.Paths {
+			paths[i] = scalar(p)
+		}
+		// Path lists can be long, so they're rendered in block style.
+		filters = append(filters, field{
+			"paths",
+			&yaml.Node{Kind: yaml.SequenceNode, Content: paths},
+		})
+	}
+	on := mapping(field{w.Identifier.Trigger(), mapping(filters...)})
+	if w.Identifier.Trigger() == "schedule" {
+		on = mapping(
+			field{
+				"schedule",
+				&yaml.Node{
+					Kind: yaml.SequenceNode,
+					Content: []*yaml.Node{
+						mapping(field{"cron", scalar(w.Schedule)}),
+					},
+				},
+			},
+			field{"workflow_dispatch", mapping()},
+		)
+	}
 	node := mapping(
-		field{"name", scalar(w.Identifier.String())},
-		field{
-			"on",
-			mapping(field{
-				w.Identifier.Trigger(),
-				mapping(field{
-					"branches",
-					list(scalar("master")),
-				}),
-			}),
-		},
-		field{"jobs", mapping(jobMap...)},
+		field{"name", scalar(w.Name())},
+		field{"on", on},
+		field{"jobs", jobs},
+	)
+	node.HeadComment = fmt.Sprintf(
+		"#\nTHIS DOCUMENT WAS AUTOGENERATED\n#\n"+
+			"generator: generate-workflows %s\n"+
+			"inputs: sha256:%s\n#\n\n",
+		Version,
+		w.InputsHash,
 	)
-	node.HeadComment = "#\nTHIS DOCUMENT WAS AUTOGENERATED\n#\n\n"
 	return node, nil
 }
 
@@ -50,6 +125,10 @@ type JobStep struct {
 	// Name is the name of the job step.
 	Name string `yaml:"name,omitempty"`
 
+	// ID identifies the step within its job so that later steps can refer to
+	// its outputs (e.g., `${{ steps.<id>.outputs.<name> }}`).
+	ID string `yaml:"id,omitempty"`
+
 	// Env is a mapping of environment variables to make available to the job
 	// step.
 	Env map[string]string `yaml:"env,omitempty"`
@@ -61,6 +140,15 @@ type JobStep struct {
 	// Uses is the 'uses' declaration for the job step.  This is used to invoke
 	// published Actions.
 	Uses string `yaml:"uses,omitempty"`
+
+	// With is a mapping of inputs to the Action invoked by `Uses`. Like
+	// `Run`, the values can include Go template variables.
+	With map[string]string `yaml:"with,omitempty"`
+
+	// pinnedRef is the original tag or branch of a step whose 'uses' has been
+	// pinned to a commit SHA (see `ActionLock.Pin`). It's rendered as a
+	// trailing comment.
+	pinnedRef string
 }
 
 // Job represents a concrete GitHub Actions job.  It has everything it needs to
@@ -79,6 +167,54 @@ type Job struct {
 	// job.
 	ProjectPath string
 
+	// ProjectPaths are the repo-relative paths on which the job's project
+	// depends: `ProjectPath` followed by the project's `Paths`.
+	ProjectPaths []string
+
+	// ProjectType is the type of the project associated with the job.
+	ProjectType *ProjectType
+
+	// DeclaredIn are the sorted, repo-relative paths of the project files
+	// which call for the job: the file of the job's own project and/or the
+	// files of the projects which depend on it.
+	DeclaredIn []string
+
+	// JobType is the name of the job type from which the job was
+	// materialized.
+	JobType string
+
+	// Variant is the item of the job type's `ForEach` parameter for which
+	// the job was materialized, if any.
+	Variant string
+
+	// Versions are the versions of the tools which the job's project
+	// declares (see `Project.Versions`).
+	Versions map[string]string
+
+	// Aggregate is set if the job was materialized from one of its project
+	// type's `Aggregates` rather than for a single project. Its
+	// `ProjectPath` is empty.
+	Aggregate bool
+
+	// If is the job's GitHub Actions condition, if any.
+	If string
+
+	// Secrets is the allowlist of repository secrets which the job may
+	// reference (see `JobType.Secrets`).
+	Secrets []string
+
+	// Environment is the GitHub deployment environment of the job, if any.
+	Environment string
+
+	// Permissions are the job's `GITHUB_TOKEN` permissions, if any (see
+	// `JobType.Permissions`).
+	Permissions map[string]string
+
+	// Required indicates whether the job should be a required status check
+	// for merging pull requests. Jobs of path-filtered workflows (see
+	// `SplitWorkflows`) aren't required.
+	Required bool
+
 	// Dependencies is a list of identifiers for jobs which must be completed
 	// before this job can begin.
 	Dependencies []string
@@ -90,54 +226,158 @@ type Job struct {
 	Steps []JobStep
 }
 
+// provenance describes where the job came from. It's rendered as a comment
+// above the job so that reviewers can trace the job back to its source.
+func (j *Job) provenance() string {
+	if j.Aggregate {
+		return fmt.Sprintf(
+			"aggregate of: %s projects\njob type: %s",
+			j.ProjectType.Identifier,
+			j.JobType,
+		)
+	}
+	return fmt.Sprintf(
+		"project: %s (type: %s)\ndeclared in: %s\njob type: %s",
+		j.ProjectPath,
+		j.ProjectType.Identifier,
+		strings.Join(j.DeclaredIn, ", "),
+		j.JobType,
+	)
+}
+
 // MarshalYAML marshals a job into YAML. The resulting YAML satisfies the GitHub
 // Actions `Job` specification.
 func (j *Job) MarshalYAML() (interface{}, error) {
-	var out = struct {
-		Needs  []string  `yaml:"needs,omitempty"`
-		RunsOn string    `yaml:"runs-on,omitempty"`
-		Steps  []JobStep `yaml:"steps,omitempty"`
-	}{
-		Needs:  j.Dependencies,
-		RunsOn: j.RunsOn,
-		Steps:  make([]JobStep, len(j.Steps)),
+	return j.node()
+}
+
+// node builds the YAML node for a job. Encoding a `*yaml.Node` into another
+// node discards its comments, so the step nodes are spliced in by hand.
+func (j *Job) node() (*yaml.Node, error) {
+	steps, err := j.RenderSteps()
+	if err != nil {
+		return nil, err
 	}
 
-	for i, step := range j.Steps {
-		var sb strings.Builder
-		t, err := template.New("").Parse(step.Run)
-		if err != nil {
+	nodes := make([]*yaml.Node, len(steps))
+	for i, step := range steps {
+		node := &yaml.Node{}
+		if err := node.Encode(step); err != nil {
 			return nil, fmt.Errorf(
-				"Parsing 'run' template of step '%s': %w",
+				"yaml-encoding step '%s': %w",
 				step.Name,
 				err,
 			)
 		}
-		if err := t.Execute(
-			&sb,
-			struct {
-				Name string
-				Path string
-			}{
-				j.ProjectName,
-				j.ProjectPath,
-			},
-		); err != nil {
+		if step.pinnedRef != "" {
+			for k := 0; k < len(node.Content); k += 2 {
+				if node.Content[k].Value == "uses" {
+					node.Content[k+1].LineComment = step.pinnedRef
+				}
+			}
+		}
+		nodes[i] = node
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(struct {
+		Needs       []string          `yaml:"needs,omitempty"`
+		If          string            `yaml:"if,omitempty"`
+		RunsOn      string            `yaml:"runs-on,omitempty"`
+		Environment string            `yaml:"environment,omitempty"`
+		Permissions map[string]string `yaml:"permissions,omitempty"`
+	}{
+		Needs:       j.Dependencies,
+		If:          j.If,
+		RunsOn:      j.RunsOn,
+		Environment: j.Environment,
+		Permissions: j.Permissions,
+	}); err != nil {
+		return nil, err
+	}
+	if len(nodes) > 0 {
+		node.Content = append(
+			node.Content,
+			scalar("steps"),
+			&yaml.Node{Kind: yaml.SequenceNode, Content: nodes},
+		)
+	}
+	return node, nil
+}
+
+// RenderSteps returns a copy of the job's steps with their 'run' and 'with'
+// templates executed against the job's project. Setup steps are pinned to the
+// versions of the tools which the project declares (see `SetupActions`).
+func (j *Job) RenderSteps() ([]JobStep, error) {
+	steps := make([]JobStep, len(j.Steps))
+	for i, step := range j.Steps {
+		run, err := j.render(step.Run)
+		if err != nil {
 			return nil, fmt.Errorf(
-				"Executing 'run' template of step '%s': %w",
+				"Rendering 'run' template of step '%s': %w",
 				step.Name,
 				err,
 			)
 		}
-		step.Run = sb.String()
-		out.Steps[i] = step
+		step.Run = run
+
+		if step.With != nil {
+			with := make(map[string]string, len(step.With))
+			for key, value := range step.With {
+				if with[key], err = j.render(value); err != nil {
+					return nil, fmt.Errorf(
+						"Rendering 'with.%s' template of step '%s': %w",
+						key,
+						step.Name,
+						err,
+					)
+				}
+			}
+			step.With = with
+		}
+
+		if input, version, ok := j.setupVersion(&step); ok {
+			with := map[string]string{input: version}
+			for key, value := range step.With {
+				with[key] = value
+			}
+			step.With = with
+		}
+		steps[i] = step
 	}
 
-	return out, nil
+	return steps, nil
+}
+
+// render executes a step template against the job's project. GitHub Actions
+// expressions (`${{ ... }}`) are passed through verbatim.
+func (j *Job) render(text string) (string, error) {
+	t, err := template.New("").Parse(escapeExpressions(text))
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := t.Execute(
+		&sb,
+		struct {
+			Name     string
+			Path     string
+			Variant  string
+			Versions map[string]string
+		}{
+			j.ProjectName,
+			j.ProjectPath,
+			j.Variant,
+			j.Versions,
+		},
+	); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
 }
 
 // MaterializeWorkflows takes a list of projects and returns the corresponding
-// workflows.
+// workflows. Workflows without jobs are omitted.
 func MaterializeWorkflows(projects []Project) ([]Workflow, error) {
 	return newMaterializer(projects).materializeWorkflows()
 }
@@ -147,10 +387,13 @@ type cacheKey struct {
 	projectTypeIdentifier string
 	projectPath           string
 	jobTypeName           string
+	variant               string
 }
 
 type materializer struct {
-	cache     map[cacheKey]int
+	// cache holds the jobs which have been materialized. A nil job is being
+	// materialized, so finding it again means that the jobs form a cycle.
+	cache     map[cacheKey]*Job
 	workflows []Workflow
 	projects  []Project
 }
@@ -161,7 +404,7 @@ func newMaterializer(projects []Project) *materializer {
 		workflows[i].Identifier = WorkflowIdentifier(i)
 	}
 	return &materializer{
-		cache:     map[cacheKey]int{},
+		cache:     map[cacheKey]*Job{},
 		workflows: workflows,
 		projects:  projects,
 	}
@@ -171,63 +414,179 @@ func (m *materializer) materializeWorkflows() ([]Workflow, error) {
 	for _, project := range m.projects {
 		for workflowIdentifier, jobTypes := range project.Type.Workflows {
 			for i := range jobTypes {
-				if _, err := m.materializeJob(
-					WorkflowIdentifier(workflowIdentifier),
-					&jobTypes[i],
-					&project,
-				); err != nil {
-					return nil, err
+				for _, variant := range project.variants(&jobTypes[i]) {
+					if _, err := m.materializeJob(
+						WorkflowIdentifier(workflowIdentifier),
+						&jobTypes[i],
+						&project,
+						variant,
+						project.KeyFile(),
+					); err != nil {
+						return nil, err
+					}
 				}
 			}
 		}
 	}
+	m.materializeAggregates()
 
-	return m.workflows, nil
+	var workflows []Workflow
+	for _, workflow := range m.workflows {
+		if len(workflow.Jobs) > 0 {
+			workflows = append(workflows, workflow)
+		}
+	}
+	return workflows, nil
+}
+
+// materializeAggregates adds the jobs of each project type's `Aggregates` to
+// the workflows which have jobs of that type.
+func (m *materializer) materializeAggregates() {
+	seen := map[*ProjectType]struct{}{}
+	for _, project := range m.projects {
+		projectType := project.Type
+		if _, found := seen[projectType]; found {
+			continue
+		}
+		seen[projectType] = struct{}{}
+
+		for workflow, jobTypes := range projectType.Aggregates {
+			var members []*Job
+			for _, job := range m.workflows[workflow].Jobs {
+				if job.ProjectType == projectType && !job.Aggregate {
+					members = append(members, job)
+				}
+			}
+			if len(members) < 1 {
+				continue
+			}
+
+			for i := range jobTypes {
+				jobType := &jobTypes[i]
+				job := &Job{
+					Identifier: fmt.Sprintf(
+						"%s-%s",
+						projectType.Identifier,
+						jobType.Name,
+					),
+					Name: fmt.Sprintf(
+						"%s %s",
+						projectType.Identifier,
+						jobType.Name,
+					),
+					ProjectName: projectType.Identifier,
+					ProjectType: projectType,
+					JobType:     jobType.Name,
+					Aggregate:   true,
+					If:          jobType.If,
+					Secrets:     jobType.Secrets,
+					Permissions: jobType.Permissions,
+					Required: WorkflowIdentifier(workflow).Trigger() ==
+						"pull_request" && !jobType.Optional,
+					RunsOn: jobType.RunsOn,
+					Steps:  jobType.Steps,
+				}
+				for _, member := range members {
+					job.Dependencies = append(
+						job.Dependencies,
+						member.Identifier,
+					)
+					for _, p := range member.ProjectPaths {
+						if !containsString(job.ProjectPaths, p) {
+							job.ProjectPaths = append(job.ProjectPaths, p)
+						}
+					}
+				}
+				m.workflows[workflow].Jobs = append(
+					m.workflows[workflow].Jobs,
+					job,
+				)
+			}
+		}
+	}
 }
 
 func (m *materializer) materializeJob(
 	workflow WorkflowIdentifier,
 	jobType *JobType,
 	parentProject *Project,
+	variant string,
+	declaredIn string,
 ) (*Job, error) {
 	key := cacheKey{
 		workflow:              workflow,
 		projectTypeIdentifier: parentProject.Type.Identifier,
 		projectPath:           parentProject.Path,
 		jobTypeName:           jobType.Name,
+		variant:               variant,
 	}
 
-	idx, found := m.cache[key]
-	if found {
-		return m.workflows[workflow].Jobs[idx], nil
+	if job, found := m.cache[key]; found {
+		if job == nil {
+			return nil, &Error{
+				Kind:    ErrorKindDependency,
+				File:    parentProject.KeyFile(),
+				Project: parentProject.Path,
+				Message: fmt.Sprintf(
+					"job '%s' of project '%s' depends on itself",
+					jobType.Name,
+					parentProject.Name(),
+				),
+			}
+		}
+		if !containsString(job.DeclaredIn, declaredIn) {
+			job.DeclaredIn = append(job.DeclaredIn, declaredIn)
+			sort.Strings(job.DeclaredIn)
+		}
+		return job, nil
 	}
 
-	m.cache[key] = len(m.workflows[workflow].Jobs)
+	m.cache[key] = nil
 	dependencies := make([]string, len(jobType.Dependencies))
 	for i, jobDependency := range jobType.Dependencies {
 		pid, found := parentProject.Dependencies[jobDependency.Name]
 		if !found {
-			return nil, fmt.Errorf(
-				"projects of type '%s' must have dependency called '%s', but "+
-					"no such dependency exists on project '%s'",
-				parentProject.Type.Identifier,
-				jobDependency.Name,
-				parentProject.Name(),
-			)
+			return nil, &Error{
+				Kind:    ErrorKindDependency,
+				File:    parentProject.KeyFile(),
+				Project: parentProject.Path,
+				Message: fmt.Sprintf(
+					"projects of type '%s' must have dependency called "+
+						"'%s', but no such dependency exists on project '%s'",
+					parentProject.Type.Identifier,
+					jobDependency.Name,
+					parentProject.Name(),
+				),
+			}
 		}
 		p, err := m.findProject(pid)
 		if err != nil {
-			return nil, fmt.Errorf(
-				"looking for dependency of project (path=%s, type=%s): %w",
-				pid.Path,
-				pid.Type.Identifier,
-				err,
-			)
+			return nil, &Error{
+				Kind:    ErrorKindDependency,
+				File:    parentProject.KeyFile(),
+				Project: parentProject.Path,
+				Message: fmt.Sprintf(
+					"looking for dependency of project (path=%s, type=%s): %v",
+					pid.Path,
+					pid.Type.Identifier,
+					err,
+				),
+			}
+		}
+		dependencyJobType := &parentProject.Type.Dependencies[jobDependency.Name].Workflows[workflow][jobDependency.JobIndex]
+		// A dependency's job is of the same variant only if the dependency
+		// has the variant too.
+		dependencyVariant := ""
+		if containsString(p.variants(dependencyJobType), variant) {
+			dependencyVariant = variant
 		}
 		d, err := m.materializeJob(
 			workflow,
-			&parentProject.Type.Dependencies[jobDependency.Name].Workflows[workflow][jobDependency.JobIndex],
+			dependencyJobType,
 			p,
+			dependencyVariant,
+			// The dependency is declared in the dependent's project file.
+			parentProject.KeyFile(),
 		)
 		if err != nil {
 			return nil, err
@@ -235,19 +594,82 @@ func (m *materializer) materializeJob(
 		dependencies[i] = d.Identifier
 	}
 
-	m.workflows[workflow].Jobs = append(
-		m.workflows[workflow].Jobs,
-		&Job{
-			Identifier:   fmt.Sprintf("%s-%s", parentProject.Name(), jobType.Name),
-			Name:         fmt.Sprintf("%s %s", parentProject.Name(), jobType.Name),
-			ProjectName:  parentProject.Name(),
-			ProjectPath:  parentProject.Path,
-			Dependencies: dependencies,
-			RunsOn:       jobType.RunsOn,
-			Steps:        jobType.Steps,
-		},
-	)
-	return m.workflows[workflow].Jobs[len(m.workflows[workflow].Jobs)-1], nil
+	identifier := fmt.Sprintf("%s-%s", parentProject.Name(), jobType.Name)
+	name := fmt.Sprintf("%s %s", parentProject.Name(), jobType.Name)
+	if variant != "" {
+		identifier += "-" + variant
+		name += fmt.Sprintf(" (%s)", variant)
+
+		// A dependent may reach a later variant before the earlier ones
+		// (e.g., if it lists its environments in a different order), so
+		// the previous variant's job is materialized if it doesn't exist.
+		variants := parentProject.variants(jobType)
+		if i := indexOf(variants, variant); jobType.Sequential && i > 0 {
+			previous, err := m.materializeJob(
+				workflow,
+				jobType,
+				parentProject,
+				variants[i-1],
+				declaredIn,
+			)
+			if err != nil {
+				return nil, err
+			}
+			dependencies = append(dependencies, previous.Identifier)
+		}
+	}
+
+	job := &Job{
+		Identifier:   identifier,
+		Name:         name,
+		ProjectName:  parentProject.Name(),
+		ProjectPath:  parentProject.Path,
+		ProjectPaths: append([]string{parentProject.Path}, parentProject.Paths...),
+		ProjectType:  parentProject.Type,
+		DeclaredIn:   []string{declaredIn},
+		JobType:      jobType.Name,
+		Variant:      variant,
+		Versions:     parentProject.Versions,
+		If:           jobType.If,
+		Secrets:      jobType.Secrets,
+		Permissions:  jobType.Permissions,
+		Required:     workflow.Trigger() == "pull_request" && !jobType.Optional,
+		Dependencies: dependencies,
+		RunsOn:       jobType.RunsOn,
+		Steps:        jobType.Steps,
+	}
+	environment, err := job.render(jobType.Environment)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Rendering 'environment' template of job type '%s': %w",
+			jobType.Name,
+			err,
+		)
+	}
+	job.Environment = environment
+
+	m.cache[key] = job
+	m.workflows[workflow].Jobs = append(m.workflows[workflow].Jobs, job)
+	return job, nil
+}
+
+// variants returns the items of the job type's `ForEach` parameter or, if
+// the job type has none or the project doesn't set it, a single empty
+// variant.
+func (p *Project) variants(jobType *JobType) []string {
+	if jobType.ForEach == "" || len(p.Params[jobType.ForEach]) < 1 {
+		return []string{""}
+	}
+	return p.Params[jobType.ForEach]
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
 }
 
 func (m *materializer) findProject(id ProjectIdentifier) (*Project, error) {
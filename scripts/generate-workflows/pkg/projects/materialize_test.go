@@ -0,0 +1,160 @@
+package projects
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMaterializeDeclaredIn(t *testing.T) {
+	library := ProjectType{
+		Identifier: "library",
+		Workflows: WorkflowTypes{
+			WorkflowPullRequest: {{
+				Name:  "build",
+				Steps: []JobStep{{Run: "true"}},
+			}},
+		},
+	}
+	service := ProjectType{
+		Identifier:   "service",
+		Dependencies: map[string]*ProjectType{"library": &library},
+		Workflows: WorkflowTypes{
+			WorkflowPullRequest: {{
+				Name:         "deploy",
+				Dependencies: []JobTypeDependency{{Name: "library"}},
+				Steps:        []JobStep{{Run: "true"}},
+			}},
+		},
+	}
+	dependency := func(p string) map[string]ProjectIdentifier {
+		return map[string]ProjectIdentifier{
+			"library": {Path: p, Type: &library},
+		}
+	}
+
+	workflows, err := MaterializeWorkflows([]Project{
+		{Type: &library, Path: "libs/shared"},
+		{Type: &library, Path: "libs/unused"},
+		{Type: &service, Path: "apps/a", Dependencies: dependency("libs/shared")},
+		{Type: &service, Path: "apps/b", Dependencies: dependency("libs/shared")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	declaredIn := map[string][]string{}
+	for _, job := range workflows[0].Jobs {
+		declaredIn[job.Identifier] = job.DeclaredIn
+	}
+	wanted := map[string][]string{
+		"library-shared-build": {
+			"apps/a/projects.yaml",
+			"apps/b/projects.yaml",
+			"libs/shared/projects.yaml",
+		},
+		"library-unused-build": {"libs/unused/projects.yaml"},
+		"service-a-deploy":     {"apps/a/projects.yaml"},
+		"service-b-deploy":     {"apps/b/projects.yaml"},
+	}
+	if !reflect.DeepEqual(declaredIn, wanted) {
+		t.Fatalf("Wanted %v; found %v", wanted, declaredIn)
+	}
+}
+
+func TestMaterializePermissions(t *testing.T) {
+	target := ProjectType{
+		Identifier: "target",
+		Workflows: WorkflowTypes{
+			WorkflowMerge: {{
+				Name: "apply",
+				Permissions: map[string]string{
+					"contents": "read",
+					"actions":  "read",
+				},
+				Steps: []JobStep{{Run: "true"}},
+			}},
+		},
+	}
+	workflows, err := MaterializeWorkflows([]Project{
+		{Type: &target, Path: "targets/foo"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := yaml.Marshal(workflows[0].Jobs[0])
+	if err != nil {
+		t.Fatalf("Marshaling job: %v", err)
+	}
+	wanted := "permissions:\n" +
+		"    actions: read\n" +
+		"    contents: read\n" +
+		"steps:\n"
+	if !strings.HasPrefix(string(data), wanted) {
+		t.Fatalf("Wanted:\n%s\nFound:\n%s", wanted, data)
+	}
+}
+
+func TestMaterializeSequentialVariants(t *testing.T) {
+	target := ProjectType{
+		Identifier: "target",
+		Params:     []string{"environments"},
+		Workflows: WorkflowTypes{
+			WorkflowMerge: {{
+				Name:       "apply",
+				ForEach:    "environments",
+				Sequential: true,
+				Steps:      []JobStep{{Run: "true"}},
+			}},
+		},
+	}
+	service := ProjectType{
+		Identifier:   "service",
+		Params:       []string{"environments"},
+		Dependencies: map[string]*ProjectType{"target": &target},
+		Workflows: WorkflowTypes{
+			WorkflowMerge: {{
+				Name:         "deploy",
+				ForEach:      "environments",
+				Dependencies: []JobTypeDependency{{Name: "target"}},
+				Steps:        []JobStep{{Run: "true"}},
+			}},
+		},
+	}
+
+	// The service reaches the target's `prd` job before its `dev` job.
+	workflows, err := MaterializeWorkflows([]Project{
+		{
+			Type:   &service,
+			Path:   "apps/a",
+			Params: map[string][]string{"environments": {"prd", "dev"}},
+			Dependencies: map[string]ProjectIdentifier{
+				"target": {Path: "targets/a", Type: &target},
+			},
+		},
+		{
+			Type:   &target,
+			Path:   "targets/a",
+			Params: map[string][]string{"environments": {"dev", "prd"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	needs := map[string][]string{}
+	for _, job := range workflows[0].Jobs {
+		needs[job.Identifier] = job.Dependencies
+	}
+	wanted := map[string][]string{
+		"target-a-apply-dev":   {},
+		"target-a-apply-prd":   {"target-a-apply-dev"},
+		"service-a-deploy-dev": {"target-a-apply-dev"},
+		"service-a-deploy-prd": {"target-a-apply-prd"},
+	}
+	if !reflect.DeepEqual(needs, wanted) {
+		t.Fatalf("Wanted %v; found %v", wanted, needs)
+	}
+}
@@ -2,8 +2,10 @@ package projects
 
 import (
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
 	"sort"
 
 	log "github.com/sirupsen/logrus"
@@ -34,20 +36,47 @@ type Project struct {
 	Path string
 
 	Dependencies map[string]ProjectIdentifier
+
+	// Paths are the repo-relative paths outside of `Path` on which the
+	// project depends (see `ProjectType.Paths`). Changes to them affect the
+	// project (see `AffectedProjects`) and, with a per-project `Layout`,
+	// trigger its workflows.
+	Paths []string
+
+	// Params are the project's parameters from its `projects.yaml` entry
+	// (see `ProjectType.Params`).
+	Params map[string][]string
+
+	// Versions are the versions of the tools which the project declares (see
+	// `ProjectType.Versions`).
+	Versions map[string]string
 }
 
 // Name returns the name of the project by appending the basename of the
 // project's `Path` with the project's type's identifier. This will be used as
 // a parameter to template the output files.
 func (p *Project) Name() string {
-	return fmt.Sprintf("%s-%s", p.Type.Identifier, filepath.Base(p.Path))
+	return fmt.Sprintf("%s-%s", p.Type.Identifier, path.Base(p.Path))
+}
+
+// KeyFile returns the repo-relative path to the `projects.yaml` file which
+// declares the project.
+func (p *Project) KeyFile() string {
+	return path.Join(p.Path, KeyFileName)
 }
 
 // FindProjects searches the repo root to locate project directories and builds
 // `Project`s from them. It will return an error if multiple projects were
 // detected with the same basename and type.
 func FindProjects(types []ProjectType, repoRoot string) ([]Project, error) {
-	projects, err := findProjects(types, repoRoot, repoRoot)
+	return FindProjectsFS(types, os.DirFS(repoRoot))
+}
+
+// FindProjectsFS is like `FindProjects` except that it searches a file system
+// whose root is the root of the repository (e.g., an `fstest.MapFS` or a git
+// tree). It also populates each project's `Paths` and `Versions`.
+func FindProjectsFS(types []ProjectType, repo fs.FS) ([]Project, error) {
+	projects, err := findProjects(types, repo, ".")
 	if err != nil {
 		return nil, err
 	}
@@ -57,24 +86,62 @@ func FindProjects(types []ProjectType, repoRoot string) ([]Project, error) {
 		return pi.Type.Identifier < pj.Type.Identifier && pi.Name() < pj.Name()
 	})
 
-	for i := range projects[:len(projects)-1] {
-		pi, pj := projects[i], projects[i+1]
+	for i := 1; i < len(projects); i++ {
+		pi, pj := projects[i-1], projects[i]
 		if pi.Type.Identifier == pj.Type.Identifier && pi.Name() == pj.Name() {
+			return nil, &Error{
+				Kind:    ErrorKindProjectFile,
+				File:    pj.KeyFile(),
+				Project: pj.Path,
+				Message: fmt.Sprintf(
+					"duplicate projects detected: '%s' and '%s': two "+
+						"projects may not share the same basename and "+
+						"project type",
+					pi.Path,
+					pj.Path,
+				),
+			}
+		}
+	}
+
+	for i := range projects {
+		if projects[i].Type.Paths == nil {
+			continue
+		}
+		paths, err := projects[i].Type.Paths(repo, &projects[i])
+		if err != nil {
 			return nil, fmt.Errorf(
-				"duplicate projects detected: '%s' and '%s': two projects "+
-					"may not share the same basename and project type",
-				pi.Path,
-				pj.Path,
+				"Finding paths of project (path=%s, type=%s): %w",
+				projects[i].Path,
+				projects[i].Type.Identifier,
+				err,
 			)
 		}
+		projects[i].Paths = paths
+	}
+
+	for i := range projects {
+		if projects[i].Type.Versions == nil {
+			continue
+		}
+		versions, err := projects[i].Type.Versions(repo, &projects[i])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Finding tool versions of project (path=%s, type=%s): %w",
+				projects[i].Path,
+				projects[i].Type.Identifier,
+				err,
+			)
+		}
+		projects[i].Versions = versions
 	}
 
 	return projects, nil
 }
 
 // findProjects is a recursive helper for `FindProjects`.
-func findProjects(types []ProjectType, root, dir string) ([]Project, error) {
-	parser := projectParser{types: types, repoRoot: root}
+func findProjects(types []ProjectType, repo fs.FS, dir string) ([]Project, error) {
+	parser := projectParser{types: types, repo: repo}
 	err := parser.parseProjectsRecursive(dir)
 	return parser.projects, err
 }
@@ -82,20 +149,20 @@ func findProjects(types []ProjectType, root, dir string) ([]Project, error) {
 type projectParser struct {
 	types    []ProjectType
 	projects []Project
-	repoRoot string
+	repo     fs.FS
 }
 
 func (pp *projectParser) parseProjectsRecursive(dir string) error {
-	files, err := ioutil.ReadDir(dir)
+	files, err := fs.ReadDir(pp.repo, dir)
 	if err != nil {
 		return err
 	}
 
 	for _, file := range files {
-		if file.Name() == keyFileName {
+		if file.Name() == KeyFileName {
 			log.Debugf("parsing projects directory %s", dir)
 			if err := pp.parseProjectsDirectory(dir); err != nil {
-				return fmt.Errorf("Parsing project(s) directory '%s': %s", dir, err)
+				return fmt.Errorf("Parsing project(s) directory '%s': %w", dir, err)
 			}
 
 			// for now, we will prohibit nested projects
@@ -103,7 +170,7 @@ func (pp *projectParser) parseProjectsRecursive(dir string) error {
 		}
 
 		if file.IsDir() {
-			filePath := filepath.Join(dir, file.Name())
+			filePath := path.Join(dir, file.Name())
 			if err := pp.parseProjectsRecursive(filePath); err != nil {
 				return err
 			}
@@ -118,8 +185,8 @@ func (pp *projectParser) pushProject(p Project) {
 }
 
 func (pp *projectParser) parseProjectsDirectory(dir string) error {
-	filePath := filepath.Join(dir, keyFileName)
-	data, err := ioutil.ReadFile(filePath)
+	filePath := path.Join(dir, KeyFileName)
+	data, err := fs.ReadFile(pp.repo, filePath)
 	if err != nil {
 		return err
 	}
@@ -130,64 +197,132 @@ func (pp *projectParser) parseProjectsDirectory(dir string) error {
 				Path string `yaml:"path"`
 				Type string `yaml:"type"`
 			} `yaml:"dependencies"`
+			Params map[string][]string `yaml:"params"`
 		} `yaml:"projects"`
 	}
 	if err := yaml.Unmarshal(data, &payload); err != nil {
-		return fmt.Errorf("Parsing YAML file '%s': %w", filePath, err)
-	}
-
-	path, err := filepath.Rel(pp.repoRoot, dir)
-	if err != nil {
-		return err
+		return yamlError(ErrorKindProjectFile, filePath, err)
 	}
 
 	for _, project := range payload.Projects {
 		projectType, err := pp.findType(project.Type)
 		if err != nil {
-			return err
+			return &Error{
+				Kind:    ErrorKindProjectFile,
+				File:    filePath,
+				Project: dir,
+				Message: err.Error(),
+			}
 		}
 
 		dependencies := make(map[string]ProjectIdentifier, len(project.Dependencies))
 		for dependencyName, dependency := range project.Dependencies {
 			if dependencyType, found := projectType.Dependencies[dependencyName]; found {
 				if dependencyType.Identifier != dependency.Type {
-					return fmt.Errorf(
-						"expected type '%s' for dependency '%s' of "+
-							"(path=%s, type=%s); found type '%s'",
-						dependencyType.Identifier,
-						path,
-						project.Type,
-						dependencyName,
-						dependency.Type,
-					)
+					return &Error{
+						Kind:    ErrorKindDependency,
+						File:    filePath,
+						Project: dir,
+						Message: fmt.Sprintf(
+							"expected type '%s' for dependency '%s' of "+
+								"(path=%s, type=%s); found type '%s'",
+							dependencyType.Identifier,
+							dependencyName,
+							dir,
+							project.Type,
+							dependency.Type,
+						),
+					}
 				}
 				dependencies[dependencyName] = ProjectIdentifier{
-					Path: path,
+					Path: dir,
 					Type: dependencyType,
 				}
 				continue
 			}
-			return fmt.Errorf(
-				"Unknown dependency '%s' for project type '%s'",
-				dependencyName,
-				project.Type,
-			)
+			return &Error{
+				Kind:    ErrorKindDependency,
+				File:    filePath,
+				Project: dir,
+				Message: fmt.Sprintf(
+					"unknown dependency '%s' for project type '%s'",
+					dependencyName,
+					project.Type,
+				),
+			}
+		}
+
+		if err := validateParams(projectType, project.Params); err != nil {
+			return &Error{
+				Kind:    ErrorKindProjectFile,
+				File:    filePath,
+				Project: dir,
+				Message: err.Error(),
+			}
 		}
 
 		log.Debugf(
 			"adding project (path=%s, type=%s)",
-			path,
+			dir,
 			projectType.Identifier,
 		)
 		pp.pushProject(Project{
 			Type:         projectType,
-			Path:         path,
+			Path:         dir,
 			Dependencies: dependencies,
+			Params:       project.Params,
 		})
 	}
 	return nil
 }
 
+// paramItemPattern matches the items of project parameters, which are
+// appended to job identifiers.
+var paramItemPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// validateParams checks that the project type accepts each parameter and that
+// each parameter is a non-empty list of unique names.
+func validateParams(projectType *ProjectType, params map[string][]string) error {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !containsString(projectType.Params, name) {
+			return fmt.Errorf(
+				"unknown param '%s' for project type '%s'",
+				name,
+				projectType.Identifier,
+			)
+		}
+		if len(params[name]) < 1 {
+			return fmt.Errorf("param '%s' must not be empty", name)
+		}
+		seen := map[string]struct{}{}
+		for _, item := range params[name] {
+			if !paramItemPattern.MatchString(item) {
+				return fmt.Errorf(
+					"invalid item '%s' in param '%s': items may only "+
+						"contain alphanumeric characters, '-', or '_'",
+					item,
+					name,
+				)
+			}
+			if _, found := seen[item]; found {
+				return fmt.Errorf(
+					"duplicate item '%s' in param '%s'",
+					item,
+					name,
+				)
+			}
+			seen[item] = struct{}{}
+		}
+	}
+	return nil
+}
+
 func (pp *projectParser) findType(identifier string) (*ProjectType, error) {
 	for i := range pp.types {
 		if pp.types[i].Identifier == identifier {
@@ -197,28 +332,219 @@ func (pp *projectParser) findType(identifier string) (*ProjectType, error) {
 	return nil, fmt.Errorf("project type '%s' not found", identifier)
 }
 
+// Config configures the generation of workflow files.
+type Config struct {
+	// ProjectTypes are the types of projects which may be declared in
+	// `projects.yaml` files.
+	ProjectTypes []ProjectType
+
+	// StaticFiles holds hand-written workflow files. Each file is a Go
+	// template which is executed with a `StaticData` and rendered alongside
+	// the generated workflow files. GitHub Actions expressions (`${{ ... }}`)
+	// are passed through verbatim.
+	StaticFiles fs.FS
+
+	// StaticVersions are the versions of the tools which static files use
+	// independently of any project (see `StaticData.Versions`).
+	StaticVersions map[string]string
+
+	// StaticSecrets is the allowlist of repository secrets which the jobs of
+	// static workflow files may reference. `GITHUB_TOKEN` is always
+	// permitted.
+	StaticSecrets []string
+
+	// Branches are the branches whose pull requests and pushes trigger
+	// workflows. It defaults to `DefaultBranches`.
+	Branches []string
+
+	// Schedule is the cron schedule (in UTC) of the scheduled workflows
+	// (e.g., `WorkflowDrift`). It defaults to `DefaultSchedule`.
+	Schedule string
+
+	// ActionLock maps `uses` references to the commit SHAs to which they're
+	// pinned. Generation fails if any `uses` reference in the project types
+	// or the static files has no entry (see `ActionLock.Check`).
+	ActionLock ActionLock
+
+	// Layout determines how jobs are distributed among workflow files.
+	Layout Layout
+
+	// Filter restricts the generated jobs to those of the selected projects
+	// (and the jobs they need). Static files are rendered regardless.
+	Filter ProjectFilter
+
+	// Warn, if set, is called with each non-fatal problem found during
+	// generation (e.g., see `MissingVersions`).
+	Warn func(*Error)
+
+	// PinActions causes every `uses` reference in the generated workflows and
+	// the static files to be rewritten to its locked commit SHA.
+	PinActions bool
+
+	// Generator identifies the generator's logic (e.g., a hash of its
+	// sources). The other inputs don't capture changes to code such as the
+	// project types' functions or the rendering, so it's part of the inputs
+	// hash (see `InputsHash`) to make such changes mark files stale.
+	Generator string
+}
+
+// DefaultBranches are the branches which trigger workflows if
+// `Config.Branches` is empty.
+var DefaultBranches = []string{"master"}
+
+// DefaultSchedule is the schedule of the scheduled workflows if
+// `Config.Schedule` is empty: daily at 06:00 UTC.
+const DefaultSchedule = "0 6 * * *"
+
 // RenderProjectWorkflows collects projects in the repository, builds workflows,
-// and writes workflow YAML files to disk at `outDir`.
-func RenderProjectWorkflows(
-	projectTypes []ProjectType,
-	repoRoot string,
-	outDir string,
-) error {
-	projects, err := FindProjects(projectTypes, repoRoot)
+// and writes workflow YAML files to disk at `outDir` along with the static
+// workflow files, the checks manifest, and the secrets inventory. It fails if
+// the workflows don't pass `Lint` or if any job references a secret which its
+// job type (or, for static files, `Config.StaticSecrets`) doesn't permit.
+func RenderProjectWorkflows(config *Config, repoRoot, outDir string) error {
+	return RenderProjectWorkflowsFS(config, os.DirFS(repoRoot), DirSink(outDir))
+}
+
+// RenderProjectWorkflowsFS is like `RenderProjectWorkflows` except that it
+// collects projects from a file system whose root is the root of the
+// repository and writes the rendered files into a sink.
+func RenderProjectWorkflowsFS(config *Config, repo fs.FS, sink Sink) error {
+	projects, links, repoFiles, err := discover(config, repo)
 	if err != nil {
-		return fmt.Errorf("Collecting projects: %w", err)
+		return err
+	}
+
+	hash, err := inputsHash(config, repoFiles)
+	if err != nil {
+		return fmt.Errorf("Hashing inputs: %w", err)
 	}
 
 	workflows, err := MaterializeWorkflows(projects)
 	if err != nil {
 		return fmt.Errorf("Building workflows: %w", err)
 	}
+	LinkWorkflows(workflows, links)
+	workflows = FilterWorkflows(workflows, &config.Filter)
+	if config.Warn != nil {
+		for _, warning := range MissingVersions(workflows) {
+			config.Warn(warning)
+		}
+	}
+
+	branches := config.Branches
+	if len(branches) < 1 {
+		branches = DefaultBranches
+	}
+	schedule := config.Schedule
+	if schedule == "" {
+		schedule = DefaultSchedule
+	}
+	for i := range workflows {
+		workflows[i].Branches = branches
+		workflows[i].Schedule = schedule
+		workflows[i].InputsHash = hash
+	}
+	workflows = SplitWorkflows(workflows, config.Layout)
+
+	staticFiles, err := RenderStaticTemplates(
+		config.StaticFiles,
+		&StaticData{
+			Projects: projects,
+			Branches: branches,
+			Versions: config.StaticVersions,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("Rendering static files: %w", err)
+	}
+	if config.Warn != nil {
+		warnings, err := MissingStaticVersions(staticFiles)
+		if err != nil {
+			return fmt.Errorf("Checking static files' versions: %w", err)
+		}
+		for _, warning := range warnings {
+			config.Warn(warning)
+		}
+	}
+
+	if err := config.ActionLock.Check(
+		config.ProjectTypes,
+		staticFiles,
+	); err != nil {
+		return fmt.Errorf("Checking action lock: %w", err)
+	}
+
+	if err := Lint(workflows, staticFiles); err != nil {
+		return fmt.Errorf("Linting workflows: %w", err)
+	}
+
+	if err := CheckSecretsPolicy(
+		workflows,
+		staticFiles,
+		config.StaticSecrets,
+	); err != nil {
+		return fmt.Errorf("Checking secrets: %w", err)
+	}
+
+	if config.PinActions {
+		if err := config.ActionLock.Pin(workflows); err != nil {
+			return fmt.Errorf("Pinning actions: %w", err)
+		}
+		if staticFiles, err = config.ActionLock.PinStaticFiles(
+			staticFiles,
+		); err != nil {
+			return fmt.Errorf("Pinning actions: %w", err)
+		}
+	}
 
-	if err := Render(outDir, workflows); err != nil {
+	if err := Render(sink, workflows); err != nil {
 		return fmt.Errorf("Rendering workflows: %w", err)
 	}
 
+	if err := RenderStaticFiles(sink, staticFiles); err != nil {
+		return fmt.Errorf("Rendering static files: %w", err)
+	}
+
+	manifest, err := BuildChecksManifest(workflows, staticFiles)
+	if err != nil {
+		return fmt.Errorf("Building checks manifest: %w", err)
+	}
+
+	if err := RenderChecksManifest(sink, manifest); err != nil {
+		return fmt.Errorf("Rendering checks manifest: %w", err)
+	}
+
+	inventory, err := BuildSecretsInventory(workflows, staticFiles)
+	if err != nil {
+		return fmt.Errorf("Building secrets inventory: %w", err)
+	}
+
+	if err := RenderSecretsInventory(sink, inventory); err != nil {
+		return fmt.Errorf("Rendering secrets inventory: %w", err)
+	}
+
 	return nil
 }
 
-const keyFileName = "projects.yaml"
+// discover finds the projects in the repository and the links between them.
+// It also returns the contents of every repository file it read, keyed by
+// path, for the inputs hash.
+func discover(
+	config *Config,
+	repo fs.FS,
+) ([]Project, []Link, map[string][]byte, error) {
+	recorder := newRecordingFS(repo)
+	projects, err := FindProjectsFS(config.ProjectTypes, recorder)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Collecting projects: %w", err)
+	}
+	links, err := FindLinks(config.ProjectTypes, recorder, projects)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Finding project links: %w", err)
+	}
+	return projects, links, recorder.files, nil
+}
+
+// KeyFileName is the name of the file which declares the projects in its
+// directory.
+const KeyFileName = "projects.yaml"
@@ -0,0 +1,150 @@
+// Package projectstest provides a golden-file test harness for project types.
+// Tests describe a repository in memory, run it through project discovery,
+// workflow materialization, and rendering, and compare the rendered files
+// against golden files so that changes to job definitions show up as
+// reviewable diffs. Run `go test -update` to rewrite the golden files.
+package projectstest
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// Repo is an in-memory repository. It maps slash-separated, repo-relative
+// file paths (e.g., `apps/foo/projects.yaml`) to file contents. Directories
+// are implied by the file paths.
+type Repo map[string]string
+
+// FS returns the repository as an in-memory file system.
+func (r Repo) FS() fstest.MapFS {
+	fsys := make(fstest.MapFS, len(r))
+	for path, contents := range r {
+		fsys[path] = &fstest.MapFile{Data: []byte(contents), Mode: 0644}
+	}
+	return fsys
+}
+
+// inputsHashPattern matches the inputs hash in the header of a rendered
+// workflow file.
+var inputsHashPattern = regexp.MustCompile(`(?m)^(# inputs: sha256:)[0-9a-f]+$`)
+
+// Render runs the repository through `projects.RenderProjectWorkflowsFS` and
+// returns the rendered files keyed by file name. Inputs hashes are replaced
+// with a placeholder so that golden files don't change with every change to
+// the inputs (e.g., to a project type's unrelated job types).
+func Render(t *testing.T, config *projects.Config, repo Repo) map[string]string {
+	t.Helper()
+	sink := projects.MapSink{}
+	if err := projects.RenderProjectWorkflowsFS(
+		config,
+		repo.FS(),
+		sink,
+	); err != nil {
+		t.Fatalf("Rendering project workflows: %v", err)
+	}
+
+	files := make(map[string]string, len(sink))
+	for fileName, data := range sink {
+		files[fileName] = inputsHashPattern.ReplaceAllString(
+			string(data),
+			"${1}<hash>",
+		)
+	}
+	return files
+}
+
+// AssertGolden compares the files (keyed by file name) against the golden
+// files in `dir`. Missing, unexpected, and differing files are all reported
+// as test errors. If the `-update` flag is set, the golden directory is
+// replaced with the provided files instead.
+func AssertGolden(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if *update {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatalf("Removing golden directory '%s': %v", dir, err)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Creating golden directory '%s': %v", dir, err)
+		}
+		for fileName, contents := range files {
+			filePath := filepath.Join(dir, fileName)
+			if err := ioutil.WriteFile(
+				filePath,
+				[]byte(contents),
+				0644,
+			); err != nil {
+				t.Fatalf("Writing golden file '%s': %v", filePath, err)
+			}
+		}
+		return
+	}
+
+	golden := readDir(t, dir)
+	for _, fileName := range sortedKeys(files) {
+		wanted, found := golden[fileName]
+		if !found {
+			t.Errorf(
+				"%s: unexpected file (run with -update to accept it)",
+				filepath.Join(dir, fileName),
+			)
+			continue
+		}
+		if wanted != files[fileName] {
+			t.Errorf(
+				"%s: rendered file differs from golden file (run with "+
+					"-update to accept it)\n--- wanted\n%s\n--- found\n%s",
+				filepath.Join(dir, fileName),
+				wanted,
+				files[fileName],
+			)
+		}
+	}
+	for _, fileName := range sortedKeys(golden) {
+		if _, found := files[fileName]; !found {
+			t.Errorf(
+				"%s: golden file was not rendered (run with -update to "+
+					"remove it)",
+				filepath.Join(dir, fileName),
+			)
+		}
+	}
+}
+
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Reading directory '%s': %v", dir, err)
+	}
+	files := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("Reading file '%s': %v", entry.Name(), err)
+		}
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
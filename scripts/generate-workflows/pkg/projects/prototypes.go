@@ -2,6 +2,7 @@ package projects
 
 import (
 	"fmt"
+	"io/fs"
 )
 
 // WorkflowIdentifier is an enum whose variants identify different workflows.
@@ -14,6 +15,11 @@ const (
 	// WorkflowMerge identifies the Merge workflow
 	WorkflowMerge
 
+	// WorkflowDrift identifies the Drift workflow, which runs on a schedule
+	// (see `Config.Schedule`) or on demand to detect changes which were made
+	// outside of the repository.
+	WorkflowDrift
+
 	// WorkflowMax is the 'length' of the valid workflow identifiers.  It's not
 	// a valid WorkflowIdentifier itself, but rather it's used for arrays which
 	// are indexed by WorkflowIdentifiers to designate the length.  E.g.,
@@ -28,6 +34,8 @@ func (wid WorkflowIdentifier) String() string {
 		return "Pull Request"
 	case WorkflowMerge:
 		return "Merge"
+	case WorkflowDrift:
+		return "Drift"
 	default:
 		panic(fmt.Sprintf("Invalid WorkflowIdentifier: %d", wid))
 	}
@@ -41,11 +49,23 @@ func (wid WorkflowIdentifier) Trigger() string {
 		return "pull_request"
 	case WorkflowMerge:
 		return "push"
+	case WorkflowDrift:
+		return "schedule"
 	default:
 		panic(fmt.Sprintf("Invalid WorkflowIdentifier: %d", wid))
 	}
 }
 
+// Triggers returns every GitHub Actions trigger key of the
+// WorkflowIdentifier. Scheduled workflows may also be run manually
+// (`workflow_dispatch`).
+func (wid WorkflowIdentifier) Triggers() []string {
+	if wid.Trigger() == "schedule" {
+		return []string{"schedule", "workflow_dispatch"}
+	}
+	return []string{wid.Trigger()}
+}
+
 // FileName returns the workflow filename that corresponds to the
 // WorkflowIdentifier.
 func (wid WorkflowIdentifier) FileName() string {
@@ -54,6 +74,8 @@ func (wid WorkflowIdentifier) FileName() string {
 		return "pull-request.yaml"
 	case WorkflowMerge:
 		return "merge.yaml"
+	case WorkflowDrift:
+		return "drift.yaml"
 	default:
 		panic(fmt.Sprintf("Invalid WorkflowIdentifier: %d", wid))
 	}
@@ -90,6 +112,45 @@ type JobType struct {
 
 	// Steps defines the steps to run during execution of the job.
 	Steps []JobStep
+
+	// Optional marks jobs of this type as informational; they won't be listed
+	// as required status checks in the checks manifest. Only jobs in
+	// pull-request-triggered workflows are ever required.
+	Optional bool
+
+	// ForEach, if set, names a list parameter of the project (see
+	// `ProjectType.Params`). A job of this type is materialized for each item
+	// (a "variant", e.g., an environment) with the item appended to its
+	// identifier and available to templates as `{{ .Variant }}`. If the
+	// project doesn't set the parameter, a single job without a variant is
+	// materialized.
+	ForEach string
+
+	// Sequential causes each variant's job to need the job of the previous
+	// variant in the list so that, e.g., lower environments are deployed
+	// before `prd`.
+	Sequential bool
+
+	// Secrets is the allowlist of repository secrets which jobs of this type
+	// may reference (e.g., `${{ secrets.FOO }}` or `${{ secrets['FOO'] }}`).
+	// Generation fails if a job references any other secret. `GITHUB_TOKEN`
+	// is always permitted.
+	Secrets []string
+
+	// If is the job's GitHub Actions condition (e.g., `always()` for a job
+	// which must run even if the jobs which it needs fail).
+	If string
+
+	// Environment is a template for the GitHub deployment environment of the
+	// job (e.g., `{{ .Variant }}`), whose protection rules (e.g., required
+	// reviewers) gate the job. The job has no environment if it renders
+	// empty.
+	Environment string
+
+	// Permissions are the job's `GITHUB_TOKEN` permissions (e.g.,
+	// `{"actions": "read"}`), if any. A job which declares permissions has no
+	// access to the scopes which it omits.
+	Permissions map[string]string
 }
 
 // ProjectType represents a kind of project, e.g., a Go project, a Terraform
@@ -111,4 +172,38 @@ type ProjectType struct {
 	// is intended to be a `WorkflowIdentifier` whose values are less than
 	// `WorkflowMax`.
 	Workflows WorkflowTypes
+
+	// Aggregates holds job types which are materialized once per workflow
+	// for all of the projects of this type rather than once per project. A
+	// job of an aggregate type needs every job of those projects in the
+	// workflow (e.g., to summarize their results), and its templates see the
+	// type's identifier as `{{ .Name }}` and an empty `{{ .Path }}`. It's
+	// omitted from workflows with no jobs of this type.
+	Aggregates WorkflowTypes
+
+	// Params are the names of the parameters which projects of this type may
+	// set in the `params` of their `projects.yaml` entries. Each is a list of
+	// names (see `JobType.ForEach`).
+	Params []string
+
+	// Links, if set, derives dependencies between projects of this type from
+	// their contents (e.g., a Terraform target which imports data that
+	// another target exports). It's called with every project of the type
+	// and reads project files from `repo`. Each link causes the dependent
+	// project's jobs to `needs` the dependency's jobs in every workflow.
+	Links func(repo fs.FS, projects []*Project) ([]Link, error) `json:"-"`
+
+	// Paths, if set, returns the repo-relative paths outside of a project's
+	// directory on which a project of this type depends (e.g., the shared
+	// Terraform modules which it calls). It reads project files from
+	// `repo`. The paths are stored in `Project.Paths`.
+	Paths func(repo fs.FS, project *Project) ([]string, error) `json:"-"`
+
+	// Versions, if set, returns the versions of the tools which a project of
+	// this type declares (e.g., `{"go": "1.16"}` from its `go.mod`). It reads
+	// project files from `repo`. The versions are stored in
+	// `Project.Versions`, are available to step templates as
+	// `{{ .Versions.<tool> }}`, and pin the project's setup steps (see
+	// `SetupActions`).
+	Versions func(repo fs.FS, project *Project) (map[string]string, error) `json:"-"`
 }
@@ -1,21 +1,23 @@
 package projects
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"strings"
+	"text/template"
 
 	"gopkg.in/yaml.v3"
 )
 
-// Render renders workflows into workflow YAML files in the provided output
-// directory.
-func Render(outDir string, workflows []Workflow) error {
+// Render renders workflows into workflow YAML files in the provided sink.
+func Render(sink Sink, workflows []Workflow) error {
 	for i := range workflows {
-		if err := RenderWorkflow(outDir, &workflows[i]); err != nil {
+		if err := RenderWorkflow(sink, &workflows[i]); err != nil {
 			return fmt.Errorf(
 				"rendering workflow %s: %w",
-				workflows[i].Identifier,
+				workflows[i].Name(),
 				err,
 			)
 		}
@@ -25,25 +27,132 @@ func Render(outDir string, workflows []Workflow) error {
 }
 
 // RenderWorkflow renders a single workflow into a workflow YAML file in the
-// provided output directory.
-func RenderWorkflow(outDir string, workflow *Workflow) error {
-	return withFileCreate(
-		filepath.Join(outDir, workflow.Identifier.FileName()),
-		func(file *os.File) error {
-			enc := yaml.NewEncoder(file)
-			enc.SetIndent(2)
-			return enc.Encode(workflow)
+// provided sink.
+func RenderWorkflow(sink Sink, workflow *Workflow) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(workflow); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return sink.WriteFile(workflow.FileName(), buf.Bytes())
+}
+
+// StaticData is the data with which static file templates are executed.
+type StaticData struct {
+	// Projects are all of the projects in the repository.
+	Projects []Project
+
+	// Branches are the branches whose pull requests and pushes trigger
+	// workflows.
+	Branches []string
+
+	// Versions are the versions of the tools which static files use
+	// independently of any project (see `Config.StaticVersions`), keyed like
+	// `Project.Versions` (e.g., `go`).
+	Versions map[string]string
+}
+
+// ProjectsVersion returns the version of a tool which the projects of the type
+// with the provided identifier declare (see `Project.Versions`). It returns
+// an empty string unless all of them declare the same version.
+func (data *StaticData) ProjectsVersion(identifier, tool string) string {
+	version := ""
+	for _, project := range data.ProjectsOfType(identifier) {
+		v := project.Versions[tool]
+		if v == "" || version != "" && v != version {
+			return ""
+		}
+		version = v
+	}
+	return version
+}
+
+// ProjectsOfType returns the projects whose type has the provided
+// identifier.
+func (data *StaticData) ProjectsOfType(identifier string) []Project {
+	var projects []Project
+	for _, project := range data.Projects {
+		if project.Type.Identifier == identifier {
+			projects = append(projects, project)
+		}
+	}
+	return projects
+}
+
+var staticFuncs = template.FuncMap{"join": strings.Join}
+
+// escapeExpressions rewrites the GitHub Actions expressions (`${{ ... }}`) in
+// a template's source so that executing the template passes them through
+// verbatim rather than parsing them as template actions.
+func escapeExpressions(source string) string {
+	return strings.ReplaceAll(source, "${{", `${{"{{"}}`)
+}
+
+// RenderStaticTemplates executes every file template in `templates` with the
+// provided data and returns the results keyed by slash-separated file path.
+// GitHub Actions expressions (`${{ ... }}`) are passed through verbatim.
+func RenderStaticTemplates(
+	templates fs.FS,
+	data *StaticData,
+) (map[string]string, error) {
+	files := map[string]string{}
+	if templates == nil {
+		return files, nil
+	}
+
+	if err := fs.WalkDir(
+		templates,
+		".",
+		func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			source, err := fs.ReadFile(templates, filePath)
+			if err != nil {
+				return err
+			}
+			t, err := template.New(filePath).
+				Funcs(staticFuncs).
+				Option("missingkey=error").
+				Parse(escapeExpressions(string(source)))
+			if err != nil {
+				return fmt.Errorf("Parsing template '%s': %w", filePath, err)
+			}
+			var sb strings.Builder
+			if err := t.Execute(&sb, data); err != nil {
+				return fmt.Errorf("Executing template '%s': %w", filePath, err)
+			}
+			files[filePath] = sb.String()
+			return nil
 		},
-	)
+	); err != nil {
+		return nil, err
+	}
+
+	return files, nil
 }
 
-func withFileCreate(filePath string, f func(f *os.File) error) error {
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
+// RenderStaticFiles writes the rendered static files (keyed by file name)
+// into the provided sink.
+func RenderStaticFiles(sink Sink, staticFiles map[string]string) error {
+	for fileName, contents := range staticFiles {
+		if err := sink.WriteFile(fileName, []byte(contents)); err != nil {
+			return fmt.Errorf("Writing static file '%s': %w", fileName, err)
+		}
 	}
-	if err := f(file); err != nil {
+
+	return nil
+}
+
+// renderJSON writes `v` as indented JSON into the provided sink.
+func renderJSON(sink Sink, fileName string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
 		return err
 	}
-	return file.Close()
+	return sink.WriteFile(fileName, append(data, '\n'))
 }
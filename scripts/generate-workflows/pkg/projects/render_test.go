@@ -0,0 +1,48 @@
+package projects
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderStaticTemplates(t *testing.T) {
+	templates := fstest.MapFS{
+		"static.yaml": &fstest.MapFile{Data: []byte(`on:
+  push:
+    branches: [ {{ join .Branches ", " }} ]
+jobs:
+  check:
+    if: ${{ github.event_name == 'push' }}
+    steps:
+      - run: echo "${{ secrets.FOO }}"{{ range .Projects }} {{ .Path }}{{ end }}
+`)},
+	}
+	files, err := RenderStaticTemplates(templates, &StaticData{
+		Projects: []Project{{Path: "apps/foo"}},
+		Branches: []string{"main", "dev"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wanted := `on:
+  push:
+    branches: [ main, dev ]
+jobs:
+  check:
+    if: ${{ github.event_name == 'push' }}
+    steps:
+      - run: echo "${{ secrets.FOO }}" apps/foo
+`
+	if files["static.yaml"] != wanted {
+		t.Fatalf("Wanted:\n%s\nFound:\n%s", wanted, files["static.yaml"])
+	}
+
+	if _, err := RenderStaticTemplates(
+		fstest.MapFS{
+			"static.yaml": &fstest.MapFile{Data: []byte("{{ .Missing }}")},
+		},
+		&StaticData{},
+	); err == nil {
+		t.Fatal("Wanted an error for a missing field")
+	}
+}
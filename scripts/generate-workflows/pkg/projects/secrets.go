@@ -0,0 +1,365 @@
+package projects
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretsInventoryFileName is the name of the secrets inventory file which is
+// rendered alongside the workflow files.
+const SecretsInventoryFileName = "secrets.json"
+
+// implicitSecrets are secrets which GitHub makes available to every workflow
+// and which therefore needn't appear in a `JobType.Secrets` allowlist.
+var implicitSecrets = map[string]struct{}{"GITHUB_TOKEN": {}}
+
+var (
+	expressionPattern = regexp.MustCompile(`(?s)\$\{\{(.*?)\}\}`)
+
+	// contextPattern matches property (`secrets.NAME`) and index
+	// (`secrets['NAME']` or `secrets["NAME"]`) access of the `secrets` and
+	// `vars` contexts.
+	contextPattern = regexp.MustCompile(
+		`\b(secrets|vars)\s*(?:\.\s*([A-Za-z_][A-Za-z0-9_]*)|` +
+			`\[\s*'([A-Za-z_][A-Za-z0-9_]*)'\s*\]|` +
+			`\[\s*"([A-Za-z_][A-Za-z0-9_]*)"\s*\])`,
+	)
+)
+
+// SecretsInventory lists every `secrets.*` and `vars.*` reference in the
+// materialized jobs along with the jobs and projects which use them.
+type SecretsInventory struct {
+	// Secrets are the referenced repository secrets sorted by name.
+	Secrets []ContextReference `json:"secrets"`
+
+	// Variables are the referenced configuration variables sorted by name.
+	Variables []ContextReference `json:"variables"`
+}
+
+// ContextReference describes a single secret or variable and its users.
+type ContextReference struct {
+	// Name is the name of the secret or variable.
+	Name string `json:"name"`
+
+	// Users are the jobs which reference the secret or variable.
+	Users []ContextUser `json:"users"`
+}
+
+// ContextUser identifies a job which references a secret or variable. Users
+// in static files have no project.
+type ContextUser struct {
+	// Workflow is the name of the workflow file in which the job lives.
+	Workflow string `json:"workflow"`
+
+	// Job is the job's identifier within the workflow.
+	Job string `json:"job"`
+
+	// Project is the project to which the job belongs.
+	Project *ManifestProject `json:"project,omitempty"`
+}
+
+// BuildSecretsInventory extracts every `secrets.*` and `vars.*` reference from
+// the materialized workflows and the static workflow files (keyed by file
+// name).
+func BuildSecretsInventory(
+	workflows []Workflow,
+	staticFiles map[string]string,
+) (*SecretsInventory, error) {
+	secrets := map[string][]ContextUser{}
+	variables := map[string][]ContextUser{}
+	for i := range workflows {
+		for _, job := range workflows[i].Jobs {
+			refs, err := job.contextReferences()
+			if err != nil {
+				return nil, fmt.Errorf(
+					"extracting references from job '%s': %w",
+					job.Identifier,
+					err,
+				)
+			}
+			user := ContextUser{
+				Workflow: workflows[i].FileName(),
+				Job:      job.Identifier,
+				Project: &ManifestProject{
+					Name: job.ProjectName,
+					Path: job.ProjectPath,
+					Type: job.ProjectType.Identifier,
+				},
+			}
+			for name := range refs.secrets {
+				secrets[name] = append(secrets[name], user)
+			}
+			for name := range refs.variables {
+				variables[name] = append(variables[name], user)
+			}
+		}
+	}
+
+	for _, fileName := range sortedFileNames(staticFiles) {
+		jobs, err := staticContextReferences(staticFiles[fileName])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"extracting references from static file '%s': %w",
+				fileName,
+				err,
+			)
+		}
+		for _, job := range jobs {
+			user := ContextUser{Workflow: fileName, Job: job.identifier}
+			for name := range job.refs.secrets {
+				secrets[name] = append(secrets[name], user)
+			}
+			for name := range job.refs.variables {
+				variables[name] = append(variables[name], user)
+			}
+		}
+	}
+
+	return &SecretsInventory{
+		Secrets:   sortedReferences(secrets),
+		Variables: sortedReferences(variables),
+	}, nil
+}
+
+func sortedReferences(m map[string][]ContextUser) []ContextReference {
+	references := make([]ContextReference, 0, len(m))
+	for name, users := range m {
+		references = append(references, ContextReference{name, users})
+	}
+	sort.Slice(references, func(i, j int) bool {
+		return references[i].Name < references[j].Name
+	})
+	return references
+}
+
+// CheckSecretsPolicy returns an `ErrorList` describing every job which
+// references a secret that isn't in its job type's `Secrets` allowlist and
+// every job of a static workflow file (keyed by file name) which references a
+// secret that isn't in `staticSecrets`.
+func CheckSecretsPolicy(
+	workflows []Workflow,
+	staticFiles map[string]string,
+	staticSecrets []string,
+) error {
+	var violations ErrorList
+	for i := range workflows {
+		for _, job := range workflows[i].Jobs {
+			refs, err := job.contextReferences()
+			if err != nil {
+				return fmt.Errorf(
+					"extracting references from job '%s': %w",
+					job.Identifier,
+					err,
+				)
+			}
+			for _, name := range disallowedSecrets(refs, job.Secrets) {
+				violations = append(violations, &Error{
+					Kind:    ErrorKindSecretsPolicy,
+					File:    path.Join(job.ProjectPath, KeyFileName),
+					Project: job.ProjectPath,
+					Message: fmt.Sprintf(
+						"job '%s' in workflow '%s' (project path=%s, "+
+							"type=%s, job type=%s) references secret '%s' "+
+							"which is not permitted for its job type",
+						job.Identifier,
+						workflows[i].FileName(),
+						job.ProjectPath,
+						job.ProjectType.Identifier,
+						job.JobType,
+						name,
+					),
+				})
+			}
+		}
+	}
+
+	for _, fileName := range sortedFileNames(staticFiles) {
+		jobs, err := staticContextReferences(staticFiles[fileName])
+		if err != nil {
+			return fmt.Errorf(
+				"extracting references from static file '%s': %w",
+				fileName,
+				err,
+			)
+		}
+		for _, job := range jobs {
+			for _, name := range disallowedSecrets(job.refs, staticSecrets) {
+				violations = append(violations, &Error{
+					Kind: ErrorKindSecretsPolicy,
+					File: path.Join(".github/workflows", fileName),
+					Message: fmt.Sprintf(
+						"job '%s' in static file '%s' references secret "+
+							"'%s' which is not permitted for static files",
+						job.identifier,
+						fileName,
+						name,
+					),
+				})
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("secrets policy violations: %w", violations)
+	}
+	return nil
+}
+
+// disallowedSecrets returns the sorted names of the referenced secrets which
+// are neither implicit nor in `allowed`.
+func disallowedSecrets(refs contextReferences, allowed []string) []string {
+	permitted := make(map[string]struct{}, len(allowed))
+	for _, secret := range allowed {
+		permitted[secret] = struct{}{}
+	}
+	var names []string
+	for name := range refs.secrets {
+		if _, ok := implicitSecrets[name]; ok {
+			continue
+		}
+		if _, ok := permitted[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedFileNames(files map[string]string) []string {
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	return fileNames
+}
+
+type contextReferences struct {
+	secrets   map[string]struct{}
+	variables map[string]struct{}
+}
+
+func newContextReferences() contextReferences {
+	return contextReferences{
+		secrets:   map[string]struct{}{},
+		variables: map[string]struct{}{},
+	}
+}
+
+// add collects the secrets and variables referenced by the expressions in
+// `value`.
+func (refs contextReferences) add(value string) {
+	for _, expr := range expressionPattern.FindAllStringSubmatch(value, -1) {
+		for _, match := range contextPattern.FindAllStringSubmatch(
+			expr[1],
+			-1,
+		) {
+			name := match[2] + match[3] + match[4]
+			if match[1] == "secrets" {
+				refs.secrets[name] = struct{}{}
+			} else {
+				refs.variables[name] = struct{}{}
+			}
+		}
+	}
+}
+
+// staticJobReferences are the references of a single job of a static
+// workflow file.
+type staticJobReferences struct {
+	identifier string
+	refs       contextReferences
+}
+
+// staticContextReferences collects the secrets and variables referenced by
+// each job of a static workflow file. References outside of `jobs` (e.g., in
+// a workflow-level `env`) are attributed to every job, since every job sees
+// them.
+func staticContextReferences(contents string) ([]staticJobReferences, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(contents), &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) < 1 ||
+		document.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("workflow isn't a mapping")
+	}
+
+	workflowRefs := newContextReferences()
+	var jobsNode *yaml.Node
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "jobs" {
+			jobsNode = root.Content[i+1]
+			continue
+		}
+		addScalars(workflowRefs, root.Content[i+1])
+	}
+	if jobsNode == nil || jobsNode.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("missing or invalid 'jobs' field")
+	}
+
+	jobs := make([]staticJobReferences, 0, len(jobsNode.Content)/2)
+	for i := 0; i+1 < len(jobsNode.Content); i += 2 {
+		job := staticJobReferences{
+			identifier: jobsNode.Content[i].Value,
+			refs:       newContextReferences(),
+		}
+		addScalars(job.refs, jobsNode.Content[i+1])
+		for name := range workflowRefs.secrets {
+			job.refs.secrets[name] = struct{}{}
+		}
+		for name := range workflowRefs.variables {
+			job.refs.variables[name] = struct{}{}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// addScalars adds the references in every scalar of a YAML node.
+func addScalars(refs contextReferences, node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		refs.add(node.Value)
+		return
+	}
+	for _, child := range node.Content {
+		addScalars(refs, child)
+	}
+}
+
+// contextReferences collects the names of the secrets and variables
+// referenced by the job's rendered steps.
+func (j *Job) contextReferences() (contextReferences, error) {
+	refs := newContextReferences()
+
+	steps, err := j.RenderSteps()
+	if err != nil {
+		return refs, err
+	}
+
+	refs.add(j.If)
+	for _, step := range steps {
+		refs.add(step.Name)
+		refs.add(step.Run)
+		refs.add(step.Uses)
+		for _, value := range step.Env {
+			refs.add(value)
+		}
+		for _, value := range step.With {
+			refs.add(value)
+		}
+	}
+
+	return refs, nil
+}
+
+// RenderSecretsInventory writes the secrets inventory as JSON into the provided
+// sink.
+func RenderSecretsInventory(sink Sink, inventory *SecretsInventory) error {
+	return renderJSON(sink, SecretsInventoryFileName, inventory)
+}
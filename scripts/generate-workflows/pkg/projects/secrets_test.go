@@ -0,0 +1,191 @@
+package projects
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestContextReferences(t *testing.T) {
+	for _, testCase := range []struct {
+		name      string
+		value     string
+		secrets   []string
+		variables []string
+	}{
+		{
+			name:    "property",
+			value:   "${{ secrets.FOO }}",
+			secrets: []string{"FOO"},
+		},
+		{
+			name:    "single-quoted index",
+			value:   "${{ secrets['FOO'] }}",
+			secrets: []string{"FOO"},
+		},
+		{
+			name:    "double-quoted index",
+			value:   `${{ secrets[ "FOO" ] }}`,
+			secrets: []string{"FOO"},
+		},
+		{
+			name:      "several in one expression",
+			value:     "${{ secrets.FOO || vars['BAR'] }}",
+			secrets:   []string{"FOO"},
+			variables: []string{"BAR"},
+		},
+		{
+			name:    "multi-line expression",
+			value:   "${{\n  secrets.FOO\n}}",
+			secrets: []string{"FOO"},
+		},
+		{
+			name:  "outside of an expression",
+			value: "echo secrets.FOO",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			refs := newContextReferences()
+			refs.add(testCase.value)
+			if got := sortedSet(refs.secrets); !reflect.DeepEqual(
+				got,
+				testCase.secrets,
+			) {
+				t.Errorf("secrets: wanted %v; found %v", testCase.secrets, got)
+			}
+			if got := sortedSet(refs.variables); !reflect.DeepEqual(
+				got,
+				testCase.variables,
+			) {
+				t.Errorf(
+					"variables: wanted %v; found %v",
+					testCase.variables,
+					got,
+				)
+			}
+		})
+	}
+}
+
+func TestCheckSecretsPolicy(t *testing.T) {
+	projectType := ProjectType{Identifier: "foo"}
+	job := func(secrets []string, env string) *Job {
+		return &Job{
+			Identifier:  "foo-bar-build",
+			ProjectPath: "bar",
+			ProjectType: &projectType,
+			JobType:     "build",
+			Secrets:     secrets,
+			Steps: []JobStep{{
+				Run: "true",
+				Env: map[string]string{"VALUE": env},
+			}},
+		}
+	}
+	const staticFile = `name: Static
+on: pull_request
+env:
+  TOKEN: ${{ secrets['STATIC'] }}
+jobs:
+  check:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ secrets.GITHUB_TOKEN }}
+`
+
+	for _, testCase := range []struct {
+		name          string
+		job           *Job
+		staticFiles   map[string]string
+		staticSecrets []string
+		violations    int
+	}{
+		{
+			name: "allowed by the job type",
+			job:  job([]string{"FOO"}, "${{ secrets['FOO'] }}"),
+		},
+		{
+			name:       "not allowed by the job type",
+			job:        job(nil, "${{ secrets['FOO'] }}"),
+			violations: 1,
+		},
+		{
+			name: "implicit",
+			job:  job(nil, "${{ secrets.GITHUB_TOKEN }}"),
+		},
+		{
+			name:          "allowed in static files",
+			job:           job(nil, ""),
+			staticFiles:   map[string]string{"static.yaml": staticFile},
+			staticSecrets: []string{"STATIC"},
+		},
+		{
+			name:        "not allowed in static files",
+			job:         job(nil, ""),
+			staticFiles: map[string]string{"static.yaml": staticFile},
+			violations:  1,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := CheckSecretsPolicy(
+				[]Workflow{{
+					Identifier: WorkflowPullRequest,
+					Jobs:       []*Job{testCase.job},
+				}},
+				testCase.staticFiles,
+				testCase.staticSecrets,
+			)
+			var violations ErrorList
+			if err != nil && !errors.As(err, &violations) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(violations) != testCase.violations {
+				t.Fatalf(
+					"Wanted %d violation(s); found %d: %v",
+					testCase.violations,
+					len(violations),
+					err,
+				)
+			}
+		})
+	}
+}
+
+func TestBuildSecretsInventoryStaticFiles(t *testing.T) {
+	inventory, err := BuildSecretsInventory(nil, map[string]string{
+		"static.yaml": `name: Static
+on: pull_request
+jobs:
+  check:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ secrets["FOO"] }} ${{ vars.BAR }}
+`,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wanted := &SecretsInventory{
+		Secrets: []ContextReference{{
+			Name:  "FOO",
+			Users: []ContextUser{{Workflow: "static.yaml", Job: "check"}},
+		}},
+		Variables: []ContextReference{{
+			Name:  "BAR",
+			Users: []ContextUser{{Workflow: "static.yaml", Job: "check"}},
+		}},
+	}
+	if !reflect.DeepEqual(inventory, wanted) {
+		t.Fatalf("Wanted %+v; found %+v", wanted, inventory)
+	}
+}
+
+func sortedSet(set map[string]struct{}) []string {
+	var values []string
+	for value := range set {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
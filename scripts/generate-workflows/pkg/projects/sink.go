@@ -0,0 +1,99 @@
+package projects
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sink is a destination for rendered files.
+type Sink interface {
+	// WriteFile writes a file with the provided name, which is a
+	// slash-separated path relative to the root of the sink.
+	WriteFile(name string, data []byte) error
+}
+
+// DirSink is a `Sink` which writes files into the directory at its path.
+type DirSink string
+
+// WriteFile implements the `Sink` interface. It creates the file and any
+// missing parent directories.
+func (dir DirSink) WriteFile(name string, data []byte) error {
+	filePath := filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filePath, data, 0644)
+}
+
+// MapSink is a `Sink` which collects files in memory keyed by name.
+type MapSink map[string][]byte
+
+// WriteFile implements the `Sink` interface.
+func (m MapSink) WriteFile(name string, data []byte) error {
+	m[name] = append([]byte(nil), data...)
+	return nil
+}
+
+// TarSink is a `Sink` which writes files into a tar stream. The caller must
+// call `Close()` to complete the stream.
+type TarSink struct {
+	w *tar.Writer
+}
+
+// NewTarSink creates a `TarSink` which writes a tar stream to `w`.
+func NewTarSink(w io.Writer) *TarSink {
+	return &TarSink{w: tar.NewWriter(w)}
+}
+
+// WriteFile implements the `Sink` interface. File modification times are
+// zeroed so that the stream is reproducible.
+func (s *TarSink) WriteFile(name string, data []byte) error {
+	if err := s.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Unix(0, 0).UTC(),
+	}); err != nil {
+		return err
+	}
+	_, err := s.w.Write(data)
+	return err
+}
+
+// Close writes the tar footer. It doesn't close the underlying writer.
+func (s *TarSink) Close() error {
+	return s.w.Close()
+}
+
+// ZipSink is a `Sink` which writes files into a zip stream. The caller must
+// call `Close()` to complete the stream.
+type ZipSink struct {
+	w *zip.Writer
+}
+
+// NewZipSink creates a `ZipSink` which writes a zip stream to `w`.
+func NewZipSink(w io.Writer) *ZipSink {
+	return &ZipSink{w: zip.NewWriter(w)}
+}
+
+// WriteFile implements the `Sink` interface.
+func (s *ZipSink) WriteFile(name string, data []byte) error {
+	f, err := s.w.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// Close writes the zip central directory. It doesn't close the underlying
+// writer.
+func (s *ZipSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,171 @@
+package projects
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetupAction describes an action which installs a tool, e.g.,
+// `actions/setup-go`.
+type SetupAction struct {
+	// Tool is the key of the tool's version in `Project.Versions` (e.g.,
+	// `go`).
+	Tool string
+
+	// Input is the action's input which selects the version to install
+	// (e.g., `go-version`).
+	Input string
+}
+
+// SetupActions maps action paths (`uses` references without the ref) to the
+// tools which they install. Unless a step sets the input explicitly, a step
+// which uses one of them is pinned to the version of the tool which its
+// project declares.
+var SetupActions = map[string]SetupAction{
+	"actions/setup-go":          {Tool: "go", Input: "go-version"},
+	"hashicorp/setup-terraform": {Tool: "terraform", Input: "terraform_version"},
+}
+
+// setupVersion returns the input and version which pin a step's setup action
+// to the version declared by the job's project. It returns false if the step
+// doesn't use a setup action, already sets the input, or the project doesn't
+// declare a version of the tool.
+func (j *Job) setupVersion(step *JobStep) (string, string, bool) {
+	actionPath, _ := splitUses(step.Uses)
+	action, found := SetupActions[actionPath]
+	if !found {
+		return "", "", false
+	}
+	if _, set := step.With[action.Input]; set {
+		return "", "", false
+	}
+	version, found := j.Versions[action.Tool]
+	return action.Input, version, found && version != ""
+}
+
+// MissingVersions returns a warning for each project whose jobs set up a tool
+// (see `SetupActions`) whose version the project doesn't declare (see
+// `ProjectType.Versions`) and which the step doesn't set explicitly. Such
+// steps install the action's default version, which may change at any time.
+func MissingVersions(workflows []Workflow) ErrorList {
+	type missing struct{ project, tool string }
+	seen := map[missing]struct{}{}
+	var warnings ErrorList
+	for _, workflow := range workflows {
+		for _, job := range workflow.Jobs {
+			if job.Aggregate {
+				continue
+			}
+			for i := range job.Steps {
+				step := &job.Steps[i]
+				actionPath, _ := splitUses(step.Uses)
+				action, found := SetupActions[actionPath]
+				if !found {
+					continue
+				}
+				if _, set := step.With[action.Input]; set {
+					continue
+				}
+				if job.Versions[action.Tool] != "" {
+					continue
+				}
+				key := missing{job.ProjectPath, action.Tool}
+				if _, found := seen[key]; found {
+					continue
+				}
+				seen[key] = struct{}{}
+				warnings = append(warnings, &Error{
+					Kind:    ErrorKindVersion,
+					File:    path.Join(job.ProjectPath, KeyFileName),
+					Project: job.ProjectPath,
+					Message: fmt.Sprintf(
+						"project doesn't declare a %s version, so '%s' "+
+							"installs its default version",
+						action.Tool,
+						actionPath,
+					),
+				})
+			}
+		}
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Project < warnings[j].Project
+	})
+	return warnings
+}
+
+// MissingStaticVersions returns a warning for each step of the rendered static
+// workflow files (keyed by file name) which uses a setup action (see
+// `SetupActions`) without setting the version to install. Static files can
+// set it from `StaticData`.
+func MissingStaticVersions(staticFiles map[string]string) (ErrorList, error) {
+	var warnings ErrorList
+	for _, fileName := range sortedFileNames(staticFiles) {
+		var document yaml.Node
+		if err := yaml.Unmarshal(
+			[]byte(staticFiles[fileName]),
+			&document,
+		); err != nil {
+			return nil, fmt.Errorf(
+				"Parsing static file '%s': %w",
+				fileName,
+				err,
+			)
+		}
+		var visit func(node *yaml.Node)
+		visit = func(node *yaml.Node) {
+			if node.Kind == yaml.MappingNode {
+				if warning := missingStepVersion(node); warning != nil {
+					warning.File = path.Join(".github/workflows", fileName)
+					warnings = append(warnings, warning)
+				}
+			}
+			for _, child := range node.Content {
+				visit(child)
+			}
+		}
+		visit(&document)
+	}
+	return warnings, nil
+}
+
+// missingStepVersion returns a warning if the mapping is a step which uses a
+// setup action without setting the version to install.
+func missingStepVersion(step *yaml.Node) *Error {
+	var uses string
+	var with *yaml.Node
+	for i := 0; i+1 < len(step.Content); i += 2 {
+		switch step.Content[i].Value {
+		case "uses":
+			uses = step.Content[i+1].Value
+		case "with":
+			with = step.Content[i+1]
+		}
+	}
+	actionPath, _ := splitUses(uses)
+	action, found := SetupActions[actionPath]
+	if !found {
+		return nil
+	}
+	if with != nil && with.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(with.Content); i += 2 {
+			if with.Content[i].Value == action.Input &&
+				with.Content[i+1].Value != "" {
+				return nil
+			}
+		}
+	}
+	return &Error{
+		Kind: ErrorKindVersion,
+		Line: step.Line,
+		Message: fmt.Sprintf(
+			"step doesn't set a %s version, so '%s' installs its default "+
+				"version",
+			action.Tool,
+			actionPath,
+		),
+	}
+}
@@ -0,0 +1,74 @@
+package projects
+
+import (
+	"testing"
+)
+
+func TestMissingStaticVersions(t *testing.T) {
+	warnings, err := MissingStaticVersions(map[string]string{
+		"check.yaml": `jobs:
+  check:
+    steps:
+      - uses: actions/checkout@v2
+      - uses: actions/setup-go@v2
+        with:
+          go-version: "1.16"
+      - uses: hashicorp/setup-terraform@v1
+      - uses: actions/setup-go@v2
+        with:
+          go-version: ""
+`,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var found []string
+	for _, warning := range warnings {
+		found = append(found, warning.Error())
+	}
+	wanted := []string{
+		".github/workflows/check.yaml:8: step doesn't set a terraform " +
+			"version, so 'hashicorp/setup-terraform' installs its default " +
+			"version",
+		".github/workflows/check.yaml:9: step doesn't set a go version, so " +
+			"'actions/setup-go' installs its default version",
+	}
+	if len(found) != len(wanted) {
+		t.Fatalf("Wanted %q; found %q", wanted, found)
+	}
+	for i := range wanted {
+		if found[i] != wanted[i] {
+			t.Fatalf("Wanted %q; found %q", wanted, found)
+		}
+	}
+}
+
+func TestProjectsVersion(t *testing.T) {
+	target := &ProjectType{Identifier: "target"}
+	project := func(version string) Project {
+		return Project{
+			Type:     target,
+			Versions: map[string]string{"terraform": version},
+		}
+	}
+	for _, testCase := range []struct {
+		name     string
+		projects []Project
+		wanted   string
+	}{
+		{"agree", []Project{project("1.1.9"), project("1.1.9")}, "1.1.9"},
+		{"disagree", []Project{project("1.1.9"), project("1.2.0")}, ""},
+		{"undeclared", []Project{project("1.1.9"), project("")}, ""},
+		{"no projects", nil, ""},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			data := StaticData{Projects: testCase.projects}
+			if version := data.ProjectsVersion(
+				"target",
+				"terraform",
+			); version != testCase.wanted {
+				t.Fatalf("Wanted '%s'; found '%s'", testCase.wanted, version)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Repo-relative paths of the modules through which targets share data. See
+// `modules/contract` in the repository.
+const (
+	ExportModulePath   = "modules/contract/export"
+	ImportModulePath   = "modules/contract/import"
+	WorkloadModulePath = "modules/workload"
+)
+
+// Contract identifies the data which a system publishes in an environment.
+type Contract struct {
+	// Environment is the environment (e.g., `prd`).
+	Environment string
+
+	// System is the exporting system (e.g., `lambda-support`).
+	System string
+}
+
+// String returns the contract as `<environment>/<system>`.
+func (c Contract) String() string {
+	return c.Environment + "/" + c.System
+}
+
+// ContractReference is a module call which exports or imports a contract.
+type ContractReference struct {
+	Contract
+
+	// Call is the module call.
+	Call *ModuleCall
+
+	// Fields are the top-level keys of the contract's data which the
+	// reference provides or uses: for an export, the keys of its `data`
+	// argument and, for an import, the keys of its `data` output which the
+	// module accesses. Each maps to the location of the key or access.
+	Fields map[string]hcl.Range
+
+	// Opaque is set if `Fields` couldn't be determined statically (e.g., an
+	// export's `data` isn't an object literal or an import's entire `data`
+	// output is passed to another module).
+	Opaque bool
+}
+
+// Contracts are the contracts which a module exports and imports.
+type Contracts struct {
+	Exports []ContractReference
+	Imports []ContractReference
+}
+
+// Contracts finds the module's calls of the contract export and import
+// modules and statically determines their contracts. Exports identify their
+// contract via their `workload` argument and imports via their `environment`
+// and `target_system` arguments. These must be literals or refer to a call of
+// the workload module whose arguments are literals (e.g.,
+// `workload = module.workload`); anything else is an error. If `environment`
+// is set, `var.environment` evaluates to it, so a target which is applied in
+// several environments resolves its contracts once per environment.
+func (m *Module) Contracts(environment string) (*Contracts, hcl.Diagnostics) {
+	ctx := m.workloadContext(environment)
+
+	var contracts Contracts
+	var diags hcl.Diagnostics
+	for _, call := range m.Calls {
+		switch call.Path {
+		case ExportModulePath:
+			workload, d := call.argument(ctx, "workload")
+			diags = append(diags, d...)
+			if d.HasErrors() {
+				continue
+			}
+			contract, d := call.contract(workload, "environment", "system")
+			diags = append(diags, d...)
+			if !d.HasErrors() {
+				fields, opaque := call.exportedFields()
+				contracts.Exports = append(
+					contracts.Exports,
+					ContractReference{contract, call, fields, opaque},
+				)
+			}
+		case ImportModulePath:
+			environment, d := call.argument(ctx, "environment")
+			diags = append(diags, d...)
+			system, d2 := call.argument(ctx, "target_system")
+			diags = append(diags, d2...)
+			if d.HasErrors() || d2.HasErrors() {
+				continue
+			}
+			contract, d := call.contract(
+				cty.ObjectVal(map[string]cty.Value{
+					"environment":   environment,
+					"target_system": system,
+				}),
+				"environment",
+				"target_system",
+			)
+			diags = append(diags, d...)
+			if !d.HasErrors() {
+				fields, opaque := m.importedFields(call)
+				contracts.Imports = append(
+					contracts.Imports,
+					ContractReference{contract, call, fields, opaque},
+				)
+			}
+		}
+	}
+	return &contracts, diags
+}
+
+// workloadContext returns an evaluation context in which `module.<name>`
+// refers to the statically-known outputs of each call of the workload module
+// and, if `environment` is set, `var.environment` refers to it.
+func (m *Module) workloadContext(environment string) *hcl.EvalContext {
+	ctx := &hcl.EvalContext{Variables: map[string]cty.Value{}}
+	if environment != "" {
+		ctx.Variables["var"] = cty.ObjectVal(map[string]cty.Value{
+			"environment": cty.StringVal(environment),
+		})
+	}
+
+	modules := map[string]cty.Value{}
+	for _, call := range m.Calls {
+		if call.Path != WorkloadModulePath {
+			continue
+		}
+		outputs := map[string]cty.Value{}
+		for _, name := range []string{"environment", "system"} {
+			if attr, found := call.Attributes[name]; found {
+				if value, diags := attr.Expr.Value(ctx); !diags.HasErrors() &&
+					isKnownString(value) {
+					outputs[name] = value
+				}
+			}
+		}
+		modules[call.Name] = cty.ObjectVal(outputs)
+	}
+	ctx.Variables["module"] = cty.ObjectVal(modules)
+	return ctx
+}
+
+// argument statically evaluates the named argument of the module call.
+func (call *ModuleCall) argument(
+	ctx *hcl.EvalContext,
+	name string,
+) (cty.Value, hcl.Diagnostics) {
+	attr, found := call.Attributes[name]
+	if !found {
+		return cty.NilVal, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Missing contract argument",
+			Detail: fmt.Sprintf(
+				"Module '%s' has no '%s' argument.",
+				call.Name,
+				name,
+			),
+			Subject: &call.DeclRange,
+		}}
+	}
+	value, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() {
+		return cty.NilVal, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Contract argument is not static",
+			Detail: fmt.Sprintf(
+				"The '%s' argument of module '%s' must be a literal, "+
+					"var.environment (in a target with environments), or "+
+					"refer to a call of %s with such arguments so that the "+
+					"contract can be determined without running terraform.",
+				name,
+				call.Name,
+				WorkloadModulePath,
+			),
+			Subject: attr.Expr.Range().Ptr(),
+		}}
+	}
+	return value, nil
+}
+
+// contract extracts a contract from the environment and system attributes of
+// an object value.
+func (call *ModuleCall) contract(
+	value cty.Value,
+	environmentAttr string,
+	systemAttr string,
+) (Contract, hcl.Diagnostics) {
+	var parts [2]string
+	for i, attr := range []string{environmentAttr, systemAttr} {
+		if !value.Type().IsObjectType() || !value.Type().HasAttribute(attr) ||
+			!isKnownString(value.GetAttr(attr)) {
+			return Contract{}, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Contract is not static",
+				Detail: fmt.Sprintf(
+					"Couldn't determine the '%s' of the contract of module "+
+						"'%s' without running terraform.",
+					attr,
+					call.Name,
+				),
+				Subject: &call.DeclRange,
+			}}
+		}
+		parts[i] = value.GetAttr(attr).AsString()
+	}
+	return Contract{Environment: parts[0], System: parts[1]}, nil
+}
+
+func isKnownString(value cty.Value) bool {
+	return value.IsKnown() && !value.IsNull() && value.Type() == cty.String
+}
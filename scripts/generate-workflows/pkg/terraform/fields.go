@@ -0,0 +1,175 @@
+package terraform
+
+import (
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// exportedFields returns the keys of an export's `data` argument if it's an
+// object literal.
+func (call *ModuleCall) exportedFields() (map[string]hcl.Range, bool) {
+	attr, found := call.Attributes["data"]
+	if !found {
+		return nil, true
+	}
+	object, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return nil, true
+	}
+
+	fields := make(map[string]hcl.Range, len(object.Items))
+	for _, item := range object.Items {
+		key, diags := item.KeyExpr.Value(nil)
+		if diags.HasErrors() || !isKnownString(key) {
+			return nil, true
+		}
+		fields[key.AsString()] = item.KeyExpr.Range()
+	}
+	return fields, false
+}
+
+// importedFields finds the accesses of the `data` output of an import (e.g.,
+// `module.<name>.data.bucket_name` or `module.<name>.data["bucket_name"]`)
+// anywhere in the module. Any other use of the import's outputs makes the
+// import opaque.
+func (m *Module) importedFields(call *ModuleCall) (map[string]hcl.Range, bool) {
+	fields := map[string]hcl.Range{}
+	opaque := false
+
+	// `VisitAll` visits parents before children, so index expressions mark
+	// their collections as handled before they're visited.
+	handled := map[*hclsyntax.ScopeTraversalExpr]struct{}{}
+	for _, body := range m.bodies {
+		hclsyntax.VisitAll(body, func(node hclsyntax.Node) hcl.Diagnostics {
+			switch expr := node.(type) {
+			case *hclsyntax.IndexExpr:
+				collection, ok := expr.Collection.(*hclsyntax.ScopeTraversalExpr)
+				if !ok || !isDataOutput(collection.Traversal, call.Name) ||
+					len(collection.Traversal) != 3 {
+					return nil
+				}
+				handled[collection] = struct{}{}
+				key, diags := expr.Key.Value(nil)
+				if diags.HasErrors() || !isKnownString(key) {
+					opaque = true
+					return nil
+				}
+				fields[key.AsString()] = expr.SrcRange
+			case *hclsyntax.ScopeTraversalExpr:
+				if _, found := handled[expr]; found {
+					return nil
+				}
+				if len(expr.Traversal) < 2 ||
+					expr.Traversal.RootName() != "module" ||
+					traverseAttrName(expr.Traversal[1]) != call.Name {
+					return nil
+				}
+				if !isDataOutput(expr.Traversal, call.Name) ||
+					len(expr.Traversal) < 4 {
+					opaque = true
+					return nil
+				}
+				name, ok := traversalKey(expr.Traversal[3])
+				if !ok {
+					opaque = true
+					return nil
+				}
+				fields[name] = expr.SrcRange
+			}
+			return nil
+		})
+	}
+	return fields, opaque
+}
+
+// isDataOutput reports whether the traversal begins with
+// `module.<name>.data`.
+func isDataOutput(traversal hcl.Traversal, name string) bool {
+	return len(traversal) >= 3 &&
+		traversal.RootName() == "module" &&
+		traverseAttrName(traversal[1]) == name &&
+		traverseAttrName(traversal[2]) == "data"
+}
+
+func traverseAttrName(step hcl.Traverser) string {
+	if attr, ok := step.(hcl.TraverseAttr); ok {
+		return attr.Name
+	}
+	return ""
+}
+
+// traversalKey returns the name of an attribute or string index step.
+func traversalKey(step hcl.Traverser) (string, bool) {
+	switch step := step.(type) {
+	case hcl.TraverseAttr:
+		return step.Name, true
+	case hcl.TraverseIndex:
+		if isKnownString(step.Key) {
+			return step.Key.AsString(), true
+		}
+	}
+	return "", false
+}
+
+// FieldProblem is a discrepancy between the fields which a contract's
+// exporter provides and those which its importers use.
+type FieldProblem struct {
+	// Reference is the export (for an unused field) or the import (for a
+	// missing field) with the problem.
+	Reference ContractReference
+
+	// Field is the name of the field.
+	Field string
+
+	// Missing is set if an importer uses the field but the exporter doesn't
+	// provide it; otherwise the exporter provides the field but no importer
+	// uses it.
+	Missing bool
+
+	// Range is the location of the access (for a missing field) or the key
+	// (for an unused field).
+	Range hcl.Range
+}
+
+// CheckFields compares the fields of a contract's export with those used by
+// its imports. Opaque references are skipped: fields can't be missing from an
+// opaque export, nor unused if any import is opaque. Problems are sorted by
+// location.
+func CheckFields(export ContractReference, imports []ContractReference) []FieldProblem {
+	var problems []FieldProblem
+	used := map[string]struct{}{}
+	anyOpaque := false
+	for _, imp := range imports {
+		anyOpaque = anyOpaque || imp.Opaque
+		for field, rng := range imp.Fields {
+			used[field] = struct{}{}
+			if _, found := export.Fields[field]; !found && !export.Opaque {
+				problems = append(problems, FieldProblem{imp, field, true, rng})
+			}
+		}
+	}
+	if !export.Opaque && !anyOpaque {
+		for field, rng := range export.Fields {
+			if _, found := used[field]; !found {
+				problems = append(
+					problems,
+					FieldProblem{export, field, false, rng},
+				)
+			}
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		ri, rj := problems[i].Range, problems[j].Range
+		if ri.Filename != rj.Filename {
+			return ri.Filename < rj.Filename
+		}
+		if ri.Start.Byte != rj.Start.Byte {
+			return ri.Start.Byte < rj.Start.Byte
+		}
+		return problems[i].Field < problems[j].Field
+	})
+	return problems
+}
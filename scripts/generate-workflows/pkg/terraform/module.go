@@ -0,0 +1,247 @@
+// Package terraform statically analyzes Terraform configurations in the
+// repository. It understands only as much of the language as the generator
+// needs (e.g., module calls and literal attribute values) and never runs
+// `terraform`.
+package terraform
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Module is the statically-known contents of a Terraform module (a directory
+// of `.tf` files).
+type Module struct {
+	// Dir is the repo-relative path to the module directory.
+	Dir string
+
+	// Calls are the module's `module` blocks ordered by file name and
+	// position.
+	Calls []*ModuleCall
+
+	// RequiredVersion is the Terraform version constraint of the module's
+	// `terraform` block (e.g., `>= 0.13`), if any.
+	RequiredVersion string
+
+	// bodies are the bodies of the module's files.
+	bodies []*hclsyntax.Body
+}
+
+// ModuleCall is a `module` block.
+type ModuleCall struct {
+	// Name is the block's label.
+	Name string
+
+	// Source is the value of the `source` attribute.
+	Source string
+
+	// Path is the repo-relative path to the called module if `Source` is a
+	// local path (i.e., it starts with `./` or `../`); otherwise it's empty.
+	Path string
+
+	// Attributes are the block's attributes (including `source`) by name.
+	Attributes hclsyntax.Attributes
+
+	// DeclRange is the location of the block's header.
+	DeclRange hcl.Range
+}
+
+var moduleSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "module", LabelNames: []string{"name"}},
+		{Type: "terraform"},
+	},
+}
+
+// LoadModule parses the `.tf` files in the repo-relative directory `dir` of
+// `repo`. The returned error, if any, is `hcl.Diagnostics` whose subjects
+// identify the offending files and lines.
+func LoadModule(repo fs.FS, dir string) (*Module, error) {
+	entries, err := fs.ReadDir(repo, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	module := Module{Dir: dir}
+	var diags hcl.Diagnostics
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tf") {
+			continue
+		}
+		filePath := path.Join(dir, entry.Name())
+		src, err := fs.ReadFile(repo, filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		file, fileDiags := hclsyntax.ParseConfig(
+			src,
+			filePath,
+			hcl.Pos{Line: 1, Column: 1},
+		)
+		diags = append(diags, fileDiags...)
+		if fileDiags.HasErrors() {
+			continue
+		}
+
+		module.bodies = append(module.bodies, file.Body.(*hclsyntax.Body))
+
+		// Only `module` and `terraform` blocks are of interest, so
+		// everything else is left unparsed.
+		content, _, contentDiags := file.Body.PartialContent(moduleSchema)
+		diags = append(diags, contentDiags...)
+		for _, block := range content.Blocks {
+			if block.Type == "terraform" {
+				version, versionDiags := requiredVersion(block)
+				diags = append(diags, versionDiags...)
+				if version != "" {
+					module.RequiredVersion = version
+				}
+				continue
+			}
+			call, callDiags := newModuleCall(dir, block)
+			diags = append(diags, callDiags...)
+			if call != nil {
+				module.Calls = append(module.Calls, call)
+			}
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	sort.SliceStable(module.Calls, func(i, j int) bool {
+		return module.Calls[i].DeclRange.Filename <
+			module.Calls[j].DeclRange.Filename
+	})
+	return &module, nil
+}
+
+// requiredVersion returns the literal `required_version` of a `terraform`
+// block, if any.
+func requiredVersion(block *hcl.Block) (string, hcl.Diagnostics) {
+	body, ok := block.Body.(*hclsyntax.Body)
+	if !ok {
+		// `ParseConfig` only produces native syntax bodies.
+		panic(fmt.Sprintf("unexpected body type %T", block.Body))
+	}
+	attr, found := body.Attributes["required_version"]
+	if !found {
+		return "", nil
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || !isKnownString(value) {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid required_version",
+			Detail:   "The 'required_version' must be a literal string.",
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+	return value.AsString(), nil
+}
+
+func newModuleCall(dir string, block *hcl.Block) (*ModuleCall, hcl.Diagnostics) {
+	body, ok := block.Body.(*hclsyntax.Body)
+	if !ok {
+		// `ParseConfig` only produces native syntax bodies.
+		panic(fmt.Sprintf("unexpected body type %T", block.Body))
+	}
+
+	call := ModuleCall{
+		Name:       block.Labels[0],
+		Attributes: body.Attributes,
+		DeclRange:  block.DefRange,
+	}
+
+	source, found := body.Attributes["source"]
+	if !found {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Missing module source",
+			Detail: fmt.Sprintf(
+				"Module '%s' has no 'source' attribute.",
+				call.Name,
+			),
+			Subject: &call.DeclRange,
+		}}
+	}
+	value, diags := source.Expr.Value(nil)
+	if diags.HasErrors() || !isKnownString(value) {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid module source",
+			Detail: fmt.Sprintf(
+				"The 'source' of module '%s' must be a literal string.",
+				call.Name,
+			),
+			Subject: source.Expr.Range().Ptr(),
+		}}
+	}
+	call.Source = value.AsString()
+	if strings.HasPrefix(call.Source, "./") ||
+		strings.HasPrefix(call.Source, "../") {
+		call.Path = path.Join(dir, call.Source)
+	}
+	return &call, nil
+}
+
+// LocalModulePaths returns the sorted repo-relative paths of the local modules
+// (see `ModuleCall.Path`) which the module in `dir` calls, directly or
+// transitively. Remote modules (e.g., registry modules) are ignored.
+func LocalModulePaths(repo fs.FS, dir string) ([]string, error) {
+	visited := map[string]struct{}{dir: {}}
+	var paths []string
+	queue := []string{dir}
+	for len(queue) > 0 {
+		module, err := LoadModule(repo, queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+
+		for _, call := range module.Calls {
+			if call.Path == "" {
+				continue
+			}
+			if _, found := visited[call.Path]; found {
+				continue
+			}
+			visited[call.Path] = struct{}{}
+			if !fs.ValidPath(call.Path) {
+				return nil, hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid module source",
+					Detail: fmt.Sprintf(
+						"The source of module '%s' is outside of the "+
+							"repository.",
+						call.Name,
+					),
+					Subject: call.Attributes["source"].Expr.Range().Ptr(),
+				}}
+			}
+			if _, err := fs.Stat(repo, call.Path); err != nil {
+				return nil, hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "Module not found",
+					Detail: fmt.Sprintf(
+						"The source of module '%s' (%s) doesn't exist.",
+						call.Name,
+						call.Path,
+					),
+					Subject: call.Attributes["source"].Expr.Range().Ptr(),
+				}}
+			}
+			paths = append(paths, call.Path)
+			queue = append(queue, call.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
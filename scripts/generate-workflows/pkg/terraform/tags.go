@@ -0,0 +1,270 @@
+package terraform
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/weberc2/infra/scripts/plan-policy/pkg/policy"
+)
+
+// CheckWorkloadTags checks that the taggable resources (see
+// `policy.TaggableResourceTypes`, which the plan policy checker shares) in the
+// module in `dir` and in the local modules which it calls derive their `tags`
+// from the `tags` output of a call of `modules/workload`. Each module is
+// checked independently: within a module which declares a `tags` variable,
+// `var.tags` is assumed to derive from the workload tags, and every call of
+// such a module must pass `tags` which do. Likewise, within a module which
+// declares a `workload` variable, `var.workload.tags` is assumed to derive
+// from the workload tags, and every call of such a module must pass a
+// `workload` which refers to a call of `modules/workload`.
+// Tags derive from the workload tags if their expression refers to them
+// (e.g., `merge(module.workload.tags, {...})`), possibly through locals.
+//
+// The returned diagnostics describe the problems; the error, if any, is
+// `hcl.Diagnostics` describing modules which couldn't be loaded.
+func CheckWorkloadTags(repo fs.FS, dir string) (hcl.Diagnostics, error) {
+	paths, err := LocalModulePaths(repo, dir)
+	if err != nil {
+		return nil, err
+	}
+	modules := map[string]*Module{}
+	for _, p := range append([]string{dir}, paths...) {
+		module, err := LoadModule(repo, p)
+		if err != nil {
+			return nil, err
+		}
+		modules[p] = module
+	}
+
+	var problems hcl.Diagnostics
+	for _, p := range append([]string{dir}, paths...) {
+		problems = append(problems, modules[p].checkWorkloadTags(modules)...)
+	}
+	return problems, nil
+}
+
+func (m *Module) checkWorkloadTags(modules map[string]*Module) hcl.Diagnostics {
+	scope := tagScope{
+		workloads: map[string]struct{}{},
+		locals:    map[string]hcl.Expression{},
+		visiting:  map[string]struct{}{},
+	}
+	for _, call := range m.Calls {
+		if call.Path == WorkloadModulePath {
+			scope.workloads[call.Name] = struct{}{}
+		}
+	}
+	var resources []*hclsyntax.Block
+	for _, body := range m.bodies {
+		for _, block := range body.Blocks {
+			switch block.Type {
+			case "locals":
+				for name, attr := range block.Body.Attributes {
+					scope.locals[name] = attr.Expr
+				}
+			case "variable":
+				if len(block.Labels) == 1 && block.Labels[0] == "tags" {
+					scope.tagsVariable = true
+				}
+				if len(block.Labels) == 1 && block.Labels[0] == "workload" {
+					scope.workloadVariable = true
+				}
+			case "resource":
+				if len(block.Labels) == 2 &&
+					policy.IsTaggable(block.Labels[0]) {
+					resources = append(resources, block)
+				}
+			}
+		}
+	}
+
+	var problems hcl.Diagnostics
+	for _, resource := range resources {
+		address := resource.Labels[0] + "." + resource.Labels[1]
+		problems = append(problems, scope.check(
+			resource.Body.Attributes["tags"],
+			resource.DefRange(),
+			fmt.Sprintf("Resource '%s'", address),
+		)...)
+	}
+	for _, call := range m.Calls {
+		callee, found := modules[call.Path]
+		if !found {
+			continue
+		}
+		if callee.declaresVariable("tags") {
+			problems = append(problems, scope.check(
+				call.Attributes["tags"],
+				call.DeclRange,
+				fmt.Sprintf("Module '%s'", call.Name),
+			)...)
+		}
+		if callee.declaresVariable("workload") {
+			problems = append(problems, scope.checkWorkload(
+				call.Attributes["workload"],
+				call.DeclRange,
+				fmt.Sprintf("Module '%s'", call.Name),
+			)...)
+		}
+	}
+	return problems
+}
+
+func (m *Module) declaresVariable(name string) bool {
+	for _, body := range m.bodies {
+		for _, block := range body.Blocks {
+			if block.Type == "variable" && len(block.Labels) == 1 &&
+				block.Labels[0] == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tagScope resolves references within a module to determine whether an
+// expression derives from the workload tags.
+type tagScope struct {
+	// workloads are the names of the module's calls of `modules/workload`.
+	workloads map[string]struct{}
+
+	// locals are the expressions of the module's locals by name.
+	locals map[string]hcl.Expression
+
+	// tagsVariable is set if the module declares a `tags` variable.
+	tagsVariable bool
+
+	// workloadVariable is set if the module declares a `workload` variable.
+	workloadVariable bool
+
+	// visiting are the locals being resolved, which guards against cycles.
+	visiting map[string]struct{}
+}
+
+// check returns a problem if the `tags` attribute of a resource or module
+// call is missing or doesn't derive from the workload tags.
+func (scope *tagScope) check(
+	tags *hclsyntax.Attribute,
+	declRange hcl.Range,
+	subject string,
+) hcl.Diagnostics {
+	hint := "set 'tags' to the 'tags' output of a 'modules/workload' call"
+	switch {
+	case scope.tagsVariable:
+		hint = "set 'tags = var.tags'"
+	case scope.workloadVariable:
+		hint = "set 'tags = var.workload.tags'"
+	}
+	if tags == nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Missing workload tags",
+			Detail:   fmt.Sprintf("%s has no 'tags'; %s.", subject, hint),
+			Subject:  declRange.Ptr(),
+		}}
+	}
+	if !scope.derives(tags.Expr) {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Tags don't derive from workload tags",
+			Detail: fmt.Sprintf(
+				"The 'tags' of %s don't refer to workload tags; %s.",
+				subject,
+				hint,
+			),
+			Subject: tags.Expr.Range().Ptr(),
+		}}
+	}
+	return nil
+}
+
+// checkWorkload returns a problem if the `workload` attribute of a module call
+// is missing or doesn't refer to a call of `modules/workload`.
+func (scope *tagScope) checkWorkload(
+	workload *hclsyntax.Attribute,
+	declRange hcl.Range,
+	subject string,
+) hcl.Diagnostics {
+	hint := "set 'workload' to a 'modules/workload' call"
+	if scope.workloadVariable {
+		hint = "set 'workload = var.workload'"
+	}
+	if workload == nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Missing workload",
+			Detail:   fmt.Sprintf("%s has no 'workload'; %s.", subject, hint),
+			Subject:  declRange.Ptr(),
+		}}
+	}
+	for _, traversal := range workload.Expr.Variables() {
+		if len(traversal) < 2 {
+			continue
+		}
+		first := traverseAttrName(traversal[1])
+		switch traversal.RootName() {
+		case "module":
+			if _, found := scope.workloads[first]; found {
+				return nil
+			}
+		case "var":
+			if first == "workload" && scope.workloadVariable {
+				return nil
+			}
+		}
+	}
+	return hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  "Workload isn't a workload module",
+		Detail: fmt.Sprintf(
+			"The 'workload' of %s doesn't refer to a 'modules/workload' "+
+				"call; %s.",
+			subject,
+			hint,
+		),
+		Subject: workload.Expr.Range().Ptr(),
+	}}
+}
+
+// derives reports whether the expression refers to `module.<workload>.tags`,
+// to `var.tags` or `var.workload.tags` in a module which declares the
+// variable, or to a local which derives.
+func (scope *tagScope) derives(expr hcl.Expression) bool {
+	for _, traversal := range expr.Variables() {
+		if len(traversal) < 2 {
+			continue
+		}
+		first := traverseAttrName(traversal[1])
+		switch traversal.RootName() {
+		case "module":
+			if _, found := scope.workloads[first]; found &&
+				len(traversal) >= 3 &&
+				traverseAttrName(traversal[2]) == "tags" {
+				return true
+			}
+		case "var":
+			if first == "tags" && scope.tagsVariable {
+				return true
+			}
+			if first == "workload" && scope.workloadVariable &&
+				len(traversal) >= 3 &&
+				traverseAttrName(traversal[2]) == "tags" {
+				return true
+			}
+		case "local":
+			local, found := scope.locals[first]
+			if _, visiting := scope.visiting[first]; !found || visiting {
+				continue
+			}
+			scope.visiting[first] = struct{}{}
+			derives := scope.derives(local)
+			delete(scope.visiting, first)
+			if derives {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const workloadModule = `
+variable "environment" {}
+variable "system" {}
+output "tags" {
+  value = { environment = var.environment, system = var.system }
+}
+`
+
+// exportModule tags its resource through its `workload` variable, like
+// `modules/contract/export`.
+const exportModule = `
+variable "workload" {}
+resource "aws_s3_bucket_object" "data" {
+  bucket = "bucket"
+  key    = var.workload.system
+  tags   = var.workload.tags
+}
+`
+
+func TestCheckWorkloadTags(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		target   string
+		problems []string
+	}{
+		{
+			name: "tagged",
+			target: `
+module "workload" {
+  source      = "../../modules/workload"
+  environment = "prd"
+  system      = "foo"
+}
+resource "aws_s3_bucket" "a" {
+  tags = merge(local.tags, {})
+}
+locals {
+  tags = module.workload.tags
+}
+module "export" {
+  source   = "../../modules/export"
+  workload = module.workload
+}
+`,
+		},
+		{
+			name: "untagged",
+			target: `
+resource "aws_s3_bucket_object" "a" {}
+resource "aws_iam_user_policy_attachment" "b" {}
+`,
+			problems: []string{
+				"Resource 'aws_s3_bucket_object.a' has no 'tags'",
+			},
+		},
+		{
+			name: "not workload tags",
+			target: `
+resource "aws_s3_bucket" "a" {
+  tags = { system = "foo" }
+}
+`,
+			problems: []string{"Tags don't derive from workload tags"},
+		},
+		{
+			name: "workload isn't a workload module",
+			target: `
+module "export" {
+  source   = "../../modules/export"
+  workload = { environment = "prd", system = "foo", tags = {} }
+}
+`,
+			problems: []string{"Workload isn't a workload module"},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := fstest.MapFS{
+				"modules/workload/main.tf": {Data: []byte(workloadModule)},
+				"modules/export/main.tf":   {Data: []byte(exportModule)},
+				"targets/foo/main.tf":      {Data: []byte(testCase.target)},
+			}
+			problems, err := CheckWorkloadTags(repo, "targets/foo")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(problems) != len(testCase.problems) {
+				t.Fatalf(
+					"Wanted %d problem(s); found %d: %v",
+					len(testCase.problems),
+					len(problems),
+					problems,
+				)
+			}
+			for i, wanted := range testCase.problems {
+				if found := problems[i].Summary + " (" + problems[i].Detail +
+					")"; !strings.Contains(found, wanted) {
+					t.Errorf(
+						"Problem %d: wanted '%s'; found '%s'",
+						i,
+						wanted,
+						found,
+					)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Package textdiff renders line-oriented unified diffs. It's intended for
+// showing reviewers how generated files change. Diffs are minimal unless the
+// inputs differ in more than a few thousand lines, in which case the
+// differing region is shown as a wholesale replacement.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// Unified returns a unified diff from `a` (labeled `aName`) to `b` (labeled
+// `bName`). It returns the empty string if the inputs are equal.
+func Unified(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(ops); {
+		// Find the next change.
+		for start < len(ops) && ops[start].kind == opEqual {
+			start++
+		}
+		if start >= len(ops) {
+			break
+		}
+
+		// Extend the hunk until there are more than `2*context` unchanged
+		// lines in a row (or we run out of lines).
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+
+		hunkStart := start - context
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := end + context
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+
+		writeHunk(&sb, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, ops []op, start, end int) {
+	// Compute the 1-based line numbers at which the hunk begins in each
+	// input.
+	aLine, bLine := 1, 1
+	for _, o := range ops[:start] {
+		if o.kind != opInsert {
+			aLine++
+		}
+		if o.kind != opDelete {
+			bLine++
+		}
+	}
+
+	aCount, bCount := 0, 0
+	for _, o := range ops[start:end] {
+		if o.kind != opInsert {
+			aCount++
+		}
+		if o.kind != opDelete {
+			bCount++
+		}
+	}
+	if aCount == 0 {
+		aLine--
+	}
+	if bCount == 0 {
+		bLine--
+	}
+
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+	for _, o := range ops[start:end] {
+		switch o.kind {
+		case opEqual:
+			sb.WriteString(" ")
+		case opDelete:
+			sb.WriteString("-")
+		case opInsert:
+			sb.WriteString("+")
+		}
+		sb.WriteString(o.line)
+		sb.WriteString("\n")
+	}
+}
+
+// maxEdits bounds the work (and memory) of `diffLines`: the Myers
+// algorithm takes O((N+M)·D) time and O(D²) memory for D edits. Past the
+// bound, the differing middle of the inputs is shown as a single deletion
+// followed by a single insertion.
+const maxEdits = 2000
+
+// diffLines computes a minimal edit script from `a` to `b` with Myers'
+// algorithm after stripping their common prefix and suffix.
+func diffLines(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, op{opEqual, line})
+	}
+	ops = append(
+		ops,
+		myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...,
+	)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, op{opEqual, line})
+	}
+	return ops
+}
+
+// myers returns a minimal edit script from `a` to `b`, or a replacement of
+// all of `a` with all of `b` if more than `maxEdits` edits are needed.
+func myers(a, b []string) []op {
+	n, m := len(a), len(b)
+	// trace[d][k+d] is the furthest x reached on diagonal k (x-y) with d
+	// edits.
+	var trace [][]int
+	for d := 0; d <= n+m && d <= maxEdits; d++ {
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			switch {
+			case d == 0:
+				x = 0
+			case k == -d || (k != d && trace[d-1][k-1+d-1] <
+				trace[d-1][k+1+d-1]):
+				// Insert (move down from diagonal k+1).
+				x = trace[d-1][k+1+d-1]
+			default:
+				// Delete (move right from diagonal k-1).
+				x = trace[d-1][k-1+d-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+d] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, append(trace, v))
+			}
+		}
+		trace = append(trace, v)
+	}
+
+	ops := make([]op, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, op{opDelete, line})
+	}
+	for _, line := range b {
+		ops = append(ops, op{opInsert, line})
+	}
+	return ops
+}
+
+// backtrack recovers the edit script from the trace of `myers`.
+func backtrack(a, b []string, trace [][]int) []op {
+	var reversed []op
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+		prevX, prevY := 0, 0
+		if d > 0 {
+			prev := trace[d-1]
+			prevK := k - 1
+			if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+				prevK = k + 1
+			}
+			prevX = prev[prevK+d-1]
+			prevY = prevX - prevK
+		}
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, op{opEqual, a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				reversed = append(reversed, op{opInsert, b[y]})
+			} else {
+				x--
+				reversed = append(reversed, op{opDelete, a[x]})
+			}
+		}
+	}
+
+	ops := make([]op, len(reversed))
+	for i, o := range reversed {
+		ops[len(reversed)-1-i] = o
+	}
+	return ops
+}
+
+// noNewlineMarker is appended to the last line of an input which doesn't end
+// with a newline so that it differs from the same line with a newline and is
+// annotated as in GNU diff.
+const noNewlineMarker = "\n\\ No newline at end of file"
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += noNewlineMarker
+	}
+	return lines
+}
@@ -0,0 +1,156 @@
+package textdiff
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	for _, testCase := range []struct {
+		name   string
+		a, b   string
+		wanted string
+	}{
+		{name: "equal", a: "a\nb\n", b: "a\nb\n", wanted: ""},
+		{name: "both empty", a: "", b: "", wanted: ""},
+		{
+			name:   "from empty",
+			a:      "",
+			b:      "a\nb\n",
+			wanted: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:   "to empty",
+			a:      "a\nb\n",
+			b:      "",
+			wanted: "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "change with context",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			wanted: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n" +
+				" 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "distant changes are separate hunks",
+			a:    "x\n1\n2\n3\n4\n5\n6\n7\n8\nx\n",
+			b:    "y\n1\n2\n3\n4\n5\n6\n7\n8\ny\n",
+			wanted: "--- a\n+++ b\n" +
+				"@@ -1,4 +1,4 @@\n-x\n+y\n 1\n 2\n 3\n" +
+				"@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-x\n+y\n",
+		},
+		{
+			name: "missing trailing newline",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			wanted: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n" +
+				"-b\n\\ No newline at end of file\n+b\n",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if found := Unified("a", "b", testCase.a, testCase.b); found !=
+				testCase.wanted {
+				t.Fatalf("Wanted:\n%s\nFound:\n%s", testCase.wanted, found)
+			}
+		})
+	}
+}
+
+// TestUnifiedApplies checks that applying the diff of random inputs to the
+// first input yields the second.
+func TestUnifiedApplies(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomLines := func() string {
+		var sb strings.Builder
+		for i := random.Intn(30); i > 0; i-- {
+			// A small alphabet makes for many common lines.
+			fmt.Fprintf(&sb, "%d\n", random.Intn(5))
+		}
+		return sb.String()
+	}
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		diff := Unified("a", "b", a, b)
+		if found := apply(t, a, diff); found != b {
+			t.Fatalf(
+				"Applying the diff of %q and %q yielded %q:\n%s",
+				a,
+				b,
+				found,
+				diff,
+			)
+		}
+	}
+}
+
+// TestUnifiedLarge checks that inputs which differ in more than `maxEdits`
+// lines are diffed (as a replacement) without exhausting memory.
+func TestUnifiedLarge(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 50000; i++ {
+		fmt.Fprintf(&a, "a%d\n", i)
+		fmt.Fprintf(&b, "b%d\n", i)
+	}
+	diff := Unified("a", "b", a.String(), b.String())
+	if found := apply(t, a.String(), diff); found != b.String() {
+		t.Fatal("Applying the diff didn't yield the second input")
+	}
+}
+
+// apply applies a unified diff produced by `Unified` to `a`.
+func apply(t *testing.T, a, diff string) string {
+	t.Helper()
+	if diff == "" {
+		return a
+	}
+	source := splitLines(a)
+	var out []string
+	next := 0 // the index of the next unconsumed line of `source`
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")[2:]
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		// Rejoin the annotation of a line without a trailing newline.
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\\") {
+			line += "\n" + lines[i+1]
+			i++
+		}
+		if strings.HasPrefix(line, "@@") {
+			var aStart, aCount int
+			fields := strings.Fields(line)
+			parts := strings.Split(strings.TrimPrefix(fields[1], "-"), ",")
+			aStart, _ = strconv.Atoi(parts[0])
+			aCount, _ = strconv.Atoi(parts[1])
+			if aCount > 0 {
+				aStart--
+			}
+			out = append(out, source[next:aStart]...)
+			next = aStart
+			continue
+		}
+		switch line[0] {
+		case ' ':
+			out = append(out, source[next])
+			next++
+		case '-':
+			next++
+		case '+':
+			out = append(out, line[1:])
+		default:
+			t.Fatalf("Unexpected diff line %q", line)
+		}
+	}
+	out = append(out, source[next:]...)
+
+	if len(out) < 1 {
+		return ""
+	}
+	joined := strings.Join(out, "\n")
+	if strings.HasSuffix(joined, noNewlineMarker) {
+		return strings.TrimSuffix(joined, noNewlineMarker)
+	}
+	return joined + "\n"
+}
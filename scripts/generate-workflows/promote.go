@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// promote atomically replaces the directory `dir` with the files written by
+// `stage` into a staging directory. The staging directory lives next to `dir`
+// so that the final rename never crosses file systems. The previous
+// directory is moved aside as a backup until the new one is in place, so a
+// failure at any point leaves either the old or the new directory intact
+// (see `recoverPromotion`). Concurrent runs are serialized with a lock file
+// next to `dir`, since they share the staging and backup directories.
+func promote(dir string, stage func(stagingDir string) error) error {
+	if err := os.MkdirAll(filepath.Dir(filepath.Clean(dir)), 0755); err != nil {
+		return fmt.Errorf("Creating parent of '%s': %w", dir, err)
+	}
+	unlock, err := lockFile(promotionLockPath(dir))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := recoverPromotion(dir); err != nil {
+		return fmt.Errorf("Recovering from previous run: %w", err)
+	}
+
+	stagingDir, backupDir := promotionDirs(dir)
+	if err := os.Mkdir(stagingDir, 0755); err != nil {
+		return fmt.Errorf("Creating staging dir: %w", err)
+	}
+	promoted := false
+	defer func() {
+		if !promoted {
+			os.RemoveAll(stagingDir)
+		}
+	}()
+
+	if err := stage(stagingDir); err != nil {
+		return err
+	}
+
+	hasPrevious := true
+	if err := os.Rename(dir, backupDir); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf(
+				"Backing up '%s' to '%s': %w",
+				dir,
+				backupDir,
+				err,
+			)
+		}
+		hasPrevious = false
+	}
+
+	if err := os.Rename(stagingDir, dir); err != nil {
+		if hasPrevious {
+			if rollbackErr := os.Rename(backupDir, dir); rollbackErr != nil {
+				return fmt.Errorf(
+					"Renaming '%s' to '%s': %w (rolling back also failed: "+
+						"%v; the previous files are in '%s')",
+					stagingDir,
+					dir,
+					err,
+					rollbackErr,
+					backupDir,
+				)
+			}
+		}
+		return fmt.Errorf("Renaming '%s' to '%s': %w", stagingDir, dir, err)
+	}
+	promoted = true
+
+	if hasPrevious {
+		if err := os.RemoveAll(backupDir); err != nil {
+			warning("Removing backup dir '%s': %v", backupDir, err)
+		}
+	}
+	return nil
+}
+
+// recoverPromotion cleans up after a previous `promote` which didn't run to
+// completion. If the previous run died after moving `dir` aside but before
+// moving the staging directory into place, the backup is restored. Leftover
+// staging directories and stale backups are removed.
+func recoverPromotion(dir string) error {
+	stagingDir, backupDir := promotionDirs(dir)
+
+	if _, err := os.Stat(backupDir); err == nil {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := os.Rename(backupDir, dir); err != nil {
+				return fmt.Errorf(
+					"Restoring backup '%s' to '%s': %w",
+					backupDir,
+					dir,
+					err,
+				)
+			}
+			warning("Restored '%s' from backup left by a previous run", dir)
+		} else if err != nil {
+			return err
+		} else {
+			if err := os.RemoveAll(backupDir); err != nil {
+				return fmt.Errorf("Removing stale backup '%s': %w", backupDir, err)
+			}
+			warning("Removed stale backup '%s' left by a previous run", backupDir)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if _, err := os.Stat(stagingDir); err == nil {
+		if err := os.RemoveAll(stagingDir); err != nil {
+			return fmt.Errorf(
+				"Removing leftover staging dir '%s': %w",
+				stagingDir,
+				err,
+			)
+		}
+		warning(
+			"Removed leftover staging dir '%s' from a previous run",
+			stagingDir,
+		)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// promotionDirs returns the staging and backup directory paths for `dir`.
+// They're hidden siblings of `dir` so that renames stay on one file system.
+func promotionDirs(dir string) (string, string) {
+	parent, base := filepath.Split(filepath.Clean(dir))
+	return filepath.Join(parent, "."+base+".staging"),
+		filepath.Join(parent, "."+base+".backup")
+}
+
+// promotionLockPath returns the path of the lock file which serializes
+// promotions of `dir`. It's a hidden sibling of `dir`, like the staging and
+// backup directories.
+func promotionLockPath(dir string) string {
+	parent, base := filepath.Split(filepath.Clean(dir))
+	return filepath.Join(parent, "."+base+".lock")
+}
+
+// managedFilesName is the name of the file in the workflows directory which
+// lists the files owned by the generator. Files which aren't listed are
+// hand-written and are left alone.
+const managedFilesName = "managed-files.json"
+
+type managedFiles struct {
+	Files []string `json:"files"`
+}
+
+// readManagedFiles returns the set of files owned by the generator in `dir`.
+// A missing list is treated as empty.
+func readManagedFiles(dir string) (map[string]struct{}, error) {
+	managed := map[string]struct{}{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, managedFilesName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return managed, nil
+		}
+		return nil, err
+	}
+
+	var payload managedFiles
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("Parsing '%s': %w", managedFilesName, err)
+	}
+	for _, fileName := range payload.Files {
+		managed[fileName] = struct{}{}
+	}
+	return managed, nil
+}
+
+// stageUnmanagedFiles copies the hand-written files from the workflows
+// directory (`dir`) into the staging directory so that they survive
+// promotion, and writes the managed files list into the staging directory.
+// Only files in the previous managed files list are left behind, so generated
+// files which are no longer produced are removed on promotion. A hand-written
+// file which collides with a generated one is an error unless their contents
+// are identical, in which case the generator adopts it.
+func stageUnmanagedFiles(dir, stagingDir string) error {
+	generated, err := ioutil.ReadDir(stagingDir)
+	if err != nil {
+		return fmt.Errorf("Reading staging dir '%s': %w", stagingDir, err)
+	}
+	owned := make(map[string]struct{}, len(generated)+1)
+	for _, file := range generated {
+		owned[file.Name()] = struct{}{}
+	}
+
+	managed, err := readManagedFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	existing, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Reading dir '%s': %w", dir, err)
+	}
+	var collisions []string
+	for _, file := range existing {
+		name := file.Name()
+		if _, ok := managed[name]; ok || name == managedFilesName {
+			continue
+		}
+
+		src := filepath.Join(dir, name)
+		if _, ok := owned[name]; ok {
+			if !file.IsDir() {
+				data, err := ioutil.ReadFile(src)
+				if err != nil {
+					return fmt.Errorf("Reading file '%s': %w", src, err)
+				}
+				staged, err := ioutil.ReadFile(filepath.Join(stagingDir, name))
+				if err != nil {
+					return fmt.Errorf("Reading staged file '%s': %w", name, err)
+				}
+				// Adopt hand-written files which are identical to their
+				// generated counterparts.
+				if bytes.Equal(data, staged) {
+					continue
+				}
+			}
+			collisions = append(collisions, src)
+			continue
+		}
+
+		dst := filepath.Join(stagingDir, name)
+		if err := copyTree(src, dst); err != nil {
+			return fmt.Errorf("Copying '%s' to '%s': %w", src, dst, err)
+		}
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf(
+			"Unmanaged files collide with generated files (rename or "+
+				"delete them to let the generator manage them): %s",
+			strings.Join(collisions, ", "),
+		)
+	}
+
+	payload := managedFiles{Files: make([]string, 0, len(owned))}
+	for name := range owned {
+		payload.Files = append(payload.Files, name)
+	}
+	sort.Strings(payload.Files)
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(
+		filepath.Join(stagingDir, managedFilesName),
+		append(data, '\n'),
+		0644,
+	)
+}
+
+// copyTree copies the file or directory at `src` to `dst`, preserving
+// permissions.
+func copyTree(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, data, info.Mode().Perm())
+	}
+
+	if err := os.Mkdir(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := copyTree(
+			filepath.Join(src, entry.Name()),
+			filepath.Join(dst, entry.Name()),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
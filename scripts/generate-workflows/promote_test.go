@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes `files` (keyed by file name) into `dir`.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Creating '%s': %v", dir, err)
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(
+			filepath.Join(dir, name),
+			[]byte(contents),
+			0644,
+		); err != nil {
+			t.Fatalf("Writing '%s': %v", name, err)
+		}
+	}
+}
+
+// readFiles returns the regular files in `dir` keyed by file name.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Reading '%s': %v", dir, err)
+	}
+	files := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("Reading '%s': %v", entry.Name(), err)
+		}
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "generate-workflows-test")
+	if err != nil {
+		t.Fatalf("Creating temporary directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestPromoteUnmanagedFiles(t *testing.T) {
+	dir := filepath.Join(tempDir(t), "workflows")
+	writeFiles(t, dir, map[string]string{
+		managedFilesName: `{"files": ["old.yaml", "kept.yaml"]}`,
+		"old.yaml":       "# THIS DOCUMENT WAS AUTOGENERATED\nold\n",
+		"kept.yaml":      "old kept\n",
+		"manual.yaml":    "# THIS DOCUMENT WAS AUTOGENERATED\nmanual\n",
+		"adopted.yaml":   "adopted\n",
+	})
+
+	if err := promote(dir, func(stagingDir string) error {
+		writeFiles(t, stagingDir, map[string]string{
+			"kept.yaml":    "new kept\n",
+			"adopted.yaml": "adopted\n",
+		})
+		return stageUnmanagedFiles(dir, stagingDir)
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	files := readFiles(t, dir)
+	managed := files[managedFilesName]
+	delete(files, managedFilesName)
+	wanted := map[string]string{
+		"kept.yaml":    "new kept\n",
+		"adopted.yaml": "adopted\n",
+		// Unlisted files are hand-written, whatever they contain.
+		"manual.yaml": "# THIS DOCUMENT WAS AUTOGENERATED\nmanual\n",
+	}
+	if !reflect.DeepEqual(files, wanted) {
+		t.Fatalf("Wanted %v; found %v", wanted, files)
+	}
+
+	owned, err := readManagedFiles(dir)
+	if err != nil {
+		t.Fatalf("Reading managed files: %v", err)
+	}
+	var names []string
+	for name := range owned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if wanted := []string{"adopted.yaml", "kept.yaml"}; !reflect.DeepEqual(
+		names,
+		wanted,
+	) {
+		t.Fatalf("Managed files: wanted %v; found %s", wanted, managed)
+	}
+}
+
+func TestPromoteCollision(t *testing.T) {
+	dir := filepath.Join(tempDir(t), "workflows")
+	writeFiles(t, dir, map[string]string{"manual.yaml": "manual\n"})
+
+	err := promote(dir, func(stagingDir string) error {
+		writeFiles(t, stagingDir, map[string]string{
+			"manual.yaml": "generated\n",
+		})
+		return stageUnmanagedFiles(dir, stagingDir)
+	})
+	if err == nil || !strings.Contains(err.Error(), "manual.yaml") {
+		t.Fatalf("Wanted a collision error naming the file; found %v", err)
+	}
+
+	// The workflows directory is left untouched.
+	if files := readFiles(t, dir); !reflect.DeepEqual(
+		files,
+		map[string]string{"manual.yaml": "manual\n"},
+	) {
+		t.Fatalf("Wanted the directory to be untouched; found %v", files)
+	}
+}
+
+func TestPromoteConcurrent(t *testing.T) {
+	dir := filepath.Join(tempDir(t), "workflows")
+	const runs = 8
+	errs := make(chan error, runs)
+	for i := 0; i < runs; i++ {
+		go func(i int) {
+			errs <- promote(dir, func(stagingDir string) error {
+				return ioutil.WriteFile(
+					filepath.Join(stagingDir, "run.yaml"),
+					[]byte(strconv.Itoa(i)),
+					0644,
+				)
+			})
+		}(i)
+	}
+	for i := 0; i < runs; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if files := readFiles(t, dir); len(files) != 1 {
+		t.Fatalf("Wanted the files of a single run; found %v", files)
+	}
+}
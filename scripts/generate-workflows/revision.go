@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/gitfs"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/textdiff"
+)
+
+var (
+	rev = flag.String(
+		"rev",
+		"",
+		"render workflows from the `revision` (e.g., a branch or commit) "+
+			"without a checkout and print them instead of writing them",
+	)
+	against = flag.String(
+		"against",
+		"",
+		"print a diff of the rendered workflows from the `revision` to "+
+			"those from -rev (or the working tree if -rev is unset)",
+	)
+)
+
+// renderRevisions implements the -rev and -against modes. Both read project
+// files straight out of git objects (the working tree is used if -rev is
+// unset) and print to stdout rather than writing to the workflows directory.
+func renderRevisions(config *projects.Config, repoRoot string) error {
+	var repo fs.FS = os.DirFS(repoRoot)
+	label := "working tree"
+	if *rev != "" {
+		tree, err := gitfs.New(repoRoot, *rev)
+		if err != nil {
+			return err
+		}
+		repo, label = tree, *rev
+	}
+
+	files, err := renderFS(config, repo)
+	if err != nil {
+		return fmt.Errorf("Rendering workflows from %s: %w", label, err)
+	}
+
+	if *against == "" {
+		for _, fileName := range sortedFileNames(files) {
+			fmt.Printf("==> %s <==\n%s\n", fileName, files[fileName])
+		}
+		return nil
+	}
+
+	tree, err := gitfs.New(repoRoot, *against)
+	if err != nil {
+		return err
+	}
+	baseFiles, err := renderFS(config, tree)
+	if err != nil {
+		return fmt.Errorf("Rendering workflows from %s: %w", *against, err)
+	}
+
+	for fileName := range baseFiles {
+		if _, found := files[fileName]; !found {
+			files[fileName] = nil
+		}
+	}
+	for _, fileName := range sortedFileNames(files) {
+		fmt.Print(textdiff.Unified(
+			*against+"/"+fileName,
+			label+"/"+fileName,
+			string(baseFiles[fileName]),
+			string(files[fileName]),
+		))
+	}
+	return nil
+}
+
+func renderFS(config *projects.Config, repo fs.FS) (projects.MapSink, error) {
+	sink := projects.MapSink{}
+	if err := projects.RenderProjectWorkflowsFS(config, repo, sink); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func sortedFileNames(files projects.MapSink) []string {
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	return fileNames
+}
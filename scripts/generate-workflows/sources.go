@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// sourceFS holds the generator's own sources. Their hash identifies the
+// generator's logic (e.g., the project types' `Paths` and `Versions`
+// functions and the rendering code) in the inputs hash; see
+// `projects.Config.Generator`.
+//
+//go:embed *.go go.mod go.sum pkg
+var sourceFS embed.FS
+
+// generatorHash returns a hex-encoded SHA-256 hash of the generator's sources
+// excluding its tests.
+func generatorHash() (string, error) {
+	h := sha256.New()
+	if err := fs.WalkDir(
+		sourceFS,
+		".",
+		func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() ||
+				strings.HasSuffix(filePath, "_test.go") {
+				return err
+			}
+			data, err := fs.ReadFile(sourceFS, filePath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s %d\n", filePath, len(data))
+			h.Write(data)
+			return nil
+		},
+	); err != nil {
+		return "", fmt.Errorf("Hashing generator sources: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/terraform"
+)
+
+// terraformTargetIdentifier identifies the Terraform target project type.
+const terraformTargetIdentifier = "terraformtarget"
+
+// errorKindContract is the kind of discrepancies between the fields which a
+// contract's exporter provides and those which its importers use.
+const errorKindContract projects.ErrorKind = "contract"
+
+// contractReference is a contract export or import and the target which
+// contains it.
+type contractReference struct {
+	project *projects.Project
+	terraform.ContractReference
+
+	// environments are the target's environments in which the reference
+	// resolves to its contract (see `terraformEnvironments`).
+	environments []string
+}
+
+// terraformEnvironments returns the environments of a Terraform target (see
+// `terraformEnvironmentsParam`) or, if it has none, a single empty
+// environment.
+func terraformEnvironments(target *projects.Project) []string {
+	if environments := target.Params[terraformEnvironmentsParam]; len(
+		environments,
+	) > 0 {
+		return environments
+	}
+	return []string{""}
+}
+
+// mergeReferences adds the references which the target resolves in the
+// environment to `refs`. A reference which resolves to the same contract in
+// several environments is added once with each of the environments.
+func mergeReferences(
+	refs []contractReference,
+	target *projects.Project,
+	environment string,
+	found []terraform.ContractReference,
+) []contractReference {
+outer:
+	for _, ref := range found {
+		for i := range refs {
+			if refs[i].Call == ref.Call && refs[i].Contract == ref.Contract {
+				refs[i].environments = append(
+					refs[i].environments,
+					environment,
+				)
+				continue outer
+			}
+		}
+		refs = append(
+			refs,
+			contractReference{target, ref, []string{environment}},
+		)
+	}
+	return refs
+}
+
+// contractIndex is every contract export and import among a set of Terraform
+// targets.
+type contractIndex struct {
+	exports map[terraform.Contract]contractReference
+	imports []contractReference
+}
+
+// importsOf returns the imports of the contract.
+func (index *contractIndex) importsOf(
+	contract terraform.Contract,
+) []contractReference {
+	var imports []contractReference
+	for _, imp := range index.imports {
+		if imp.Contract == contract {
+			imports = append(imports, imp)
+		}
+	}
+	return imports
+}
+
+// loadContracts finds the contract exports and imports of the targets in each
+// of their environments. It fails if a contract is exported by more than one
+// target or in more than one environment of a target.
+func loadContracts(
+	repo fs.FS,
+	targets []*projects.Project,
+) (*contractIndex, projects.ErrorList) {
+	index := contractIndex{exports: map[terraform.Contract]contractReference{}}
+	var errs projects.ErrorList
+	for _, target := range targets {
+		module, err := terraform.LoadModule(repo, target.Path)
+		if err != nil {
+			errs = append(errs, terraformErrors(target, err)...)
+			continue
+		}
+		var exports, imports []contractReference
+		var diags hcl.Diagnostics
+		for _, environment := range terraformEnvironments(target) {
+			var contracts *terraform.Contracts
+			contracts, diags = module.Contracts(environment)
+			if diags.HasErrors() {
+				break
+			}
+			exports = mergeReferences(
+				exports,
+				target,
+				environment,
+				contracts.Exports,
+			)
+			imports = mergeReferences(
+				imports,
+				target,
+				environment,
+				contracts.Imports,
+			)
+		}
+		if diags.HasErrors() {
+			errs = append(errs, terraformErrors(target, diags)...)
+			continue
+		}
+
+		for _, export := range exports {
+			if len(export.environments) > 1 {
+				errs = append(errs, contractError(
+					projects.ErrorKindDependency,
+					target,
+					export.Call.DeclRange,
+					"contract '%s' is exported in each of environments %s; "+
+						"its environment should be var.environment",
+					export.Contract,
+					strings.Join(export.environments, ", "),
+				))
+				continue
+			}
+			if existing, found := index.exports[export.Contract]; found {
+				errs = append(errs, contractError(
+					projects.ErrorKindDependency,
+					target,
+					export.Call.DeclRange,
+					"contract '%s' is also exported by '%s'",
+					export.Contract,
+					existing.project.Path,
+				))
+				continue
+			}
+			index.exports[export.Contract] = export
+		}
+		index.imports = append(index.imports, imports...)
+	}
+	return &index, errs
+}
+
+// missingExporterError reports an import of a contract which no target
+// exports.
+func missingExporterError(imp contractReference) *projects.Error {
+	return contractError(
+		projects.ErrorKindDependency,
+		imp.project,
+		imp.Call.DeclRange,
+		"module '%s' imports contract '%s' which no target exports",
+		imp.Call.Name,
+		imp.Contract,
+	)
+}
+
+// checkContractFields compares the fields of the contract's export with
+// those used by its imports (see `terraform.CheckFields`).
+func (index *contractIndex) checkContractFields(
+	contract terraform.Contract,
+) (missing, unused []fieldProblem) {
+	export := index.exports[contract]
+	imports := index.importsOf(contract)
+	refs := make([]terraform.ContractReference, len(imports))
+	projectsByCall := map[*terraform.ModuleCall]*projects.Project{}
+	for i, imp := range imports {
+		refs[i] = imp.ContractReference
+		projectsByCall[imp.Call] = imp.project
+	}
+	projectsByCall[export.Call] = export.project
+
+	for _, problem := range terraform.CheckFields(
+		export.ContractReference,
+		refs,
+	) {
+		p := fieldProblem{projectsByCall[problem.Reference.Call], problem}
+		if problem.Missing {
+			missing = append(missing, p)
+		} else {
+			unused = append(unused, p)
+		}
+	}
+	return missing, unused
+}
+
+// fieldProblem is a `terraform.FieldProblem` and the target which contains
+// it.
+type fieldProblem struct {
+	project *projects.Project
+	terraform.FieldProblem
+}
+
+func (problem *fieldProblem) error() *projects.Error {
+	if problem.Missing {
+		return contractError(
+			errorKindContract,
+			problem.project,
+			problem.Range,
+			"module '%s' uses field '%s' which contract '%s' doesn't export",
+			problem.Reference.Call.Name,
+			problem.Field,
+			problem.Reference.Contract,
+		)
+	}
+	return contractError(
+		errorKindContract,
+		problem.project,
+		problem.Range,
+		"contract '%s' exports field '%s' which no target imports",
+		problem.Reference.Contract,
+		problem.Field,
+	)
+}
+
+// sortedContracts returns the contracts which are exported or imported
+// sorted by environment and system.
+func (index *contractIndex) sortedContracts() []terraform.Contract {
+	set := map[terraform.Contract]struct{}{}
+	for contract := range index.exports {
+		set[contract] = struct{}{}
+	}
+	for _, imp := range index.imports {
+		set[imp.Contract] = struct{}{}
+	}
+	contracts := make([]terraform.Contract, 0, len(set))
+	for contract := range set {
+		contracts = append(contracts, contract)
+	}
+	sort.Slice(contracts, func(i, j int) bool {
+		return contracts[i].String() < contracts[j].String()
+	})
+	return contracts
+}
+
+// terraformContractLinks links each Terraform target which imports a contract
+// (see `modules/contract`) to the target which exports it so that the
+// exporter is planned and applied first. Each environment in which a target
+// imports the contract is linked to the exporter's environment. It fails if a contract is imported
+// but not exported, exported by more than one target, or if an importer uses
+// a field which the exporter doesn't provide. Unused fields are only reported
+// by the `contracts` command.
+func terraformContractLinks(
+	repo fs.FS,
+	targets []*projects.Project,
+) ([]projects.Link, error) {
+	index, errs := loadContracts(repo, targets)
+
+	var links []projects.Link
+	for _, imp := range index.imports {
+		exporter, found := index.exports[imp.Contract]
+		if !found {
+			errs = append(errs, missingExporterError(imp))
+			continue
+		}
+		if exporter.project.Path == imp.project.Path {
+			continue
+		}
+		for _, environment := range imp.environments {
+			links = append(links, projects.Link{
+				Dependent:         imp.project.Path,
+				Dependency:        exporter.project.Path,
+				DependentVariant:  environment,
+				DependencyVariant: exporter.environments[0],
+				Reason: fmt.Sprintf(
+					"imports contract %s",
+					imp.Contract,
+				),
+			})
+		}
+	}
+	for _, contract := range index.sortedContracts() {
+		if _, found := index.exports[contract]; !found {
+			continue
+		}
+		missing, _ := index.checkContractFields(contract)
+		for i := range missing {
+			errs = append(errs, missing[i].error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return links, nil
+}
+
+func contractError(
+	kind projects.ErrorKind,
+	target *projects.Project,
+	subject hcl.Range,
+	format string,
+	v ...interface{},
+) *projects.Error {
+	return &projects.Error{
+		Kind:    kind,
+		File:    subject.Filename,
+		Line:    subject.Start.Line,
+		Project: target.Path,
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// planPolicyDir is the repo-relative path to the plan policy checker which
+// the plan jobs run.
+const planPolicyDir = "scripts/plan-policy"
+
+// terraformTargetPaths returns the paths of the local modules which a
+// Terraform target calls (transitively) so that changes to shared modules
+// trigger the targets which use them, along with the plan policy checker.
+func terraformTargetPaths(
+	repo fs.FS,
+	target *projects.Project,
+) ([]string, error) {
+	paths, err := terraform.LocalModulePaths(repo, target.Path)
+	if err != nil {
+		return nil, terraformErrors(target, err)
+	}
+
+	// Catch missing backend configurations here rather than in CI.
+	for _, environment := range target.Params[terraformEnvironmentsParam] {
+		backend := path.Join(
+			target.Path,
+			"environments",
+			environment+".tfbackend",
+		)
+		if _, err := fs.Stat(repo, backend); err != nil {
+			return nil, &projects.Error{
+				Kind:    projects.ErrorKindProjectFile,
+				File:    target.KeyFile(),
+				Project: target.Path,
+				Message: fmt.Sprintf(
+					"environment '%s' has no backend configuration '%s'",
+					environment,
+					backend,
+				),
+			}
+		}
+	}
+	return append(paths, planPolicyDir), nil
+}
+
+// terraformErrors converts an error from the `terraform` package into
+// structured errors which point at the offending Terraform files.
+func terraformErrors(target *projects.Project, err error) projects.ErrorList {
+	var diags hcl.Diagnostics
+	if !errors.As(err, &diags) {
+		return projects.ErrorList{{
+			Kind:    projects.ErrorKindGeneric,
+			Project: target.Path,
+			Message: err.Error(),
+		}}
+	}
+
+	var errs projects.ErrorList
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		e := projects.Error{
+			Kind:    projects.ErrorKindDependency,
+			Project: target.Path,
+			Message: diag.Summary,
+		}
+		if diag.Detail != "" {
+			e.Message += " (" + diag.Detail + ")"
+		}
+		if diag.Subject != nil {
+			e.File = diag.Subject.Filename
+			e.Line = diag.Subject.Start.Line
+		}
+		errs = append(errs, &e)
+	}
+	return errs
+}
+
+// errorKindTags is the kind of the problems found by the `tags` command.
+const errorKindTags projects.ErrorKind = "tags"
+
+// tags implements the `tags` command. It checks that the taggable resources
+// in the selected Terraform targets and the local modules which they call
+// derive their tags from a `modules/workload` call (see
+// `terraform.CheckWorkloadTags`). Problems in a module which several targets
+// call are reported once.
+func tags(env *environment, args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("tags: unexpected arguments")
+	}
+	found, err := env.findProjects()
+	if err != nil {
+		return err
+	}
+
+	repo := os.DirFS(env.repoRoot)
+	seen := map[string]struct{}{}
+	var errs projects.ErrorList
+	targets := 0
+	for i := range found {
+		target := &found[i]
+		if target.Type.Identifier != terraformTargetIdentifier {
+			continue
+		}
+		targets++
+		problems, err := terraform.CheckWorkloadTags(repo, target.Path)
+		if err != nil {
+			errs = append(errs, terraformErrors(target, err)...)
+			continue
+		}
+		for _, e := range terraformErrors(target, problems) {
+			key := fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+			if _, found := seen[key]; found {
+				continue
+			}
+			seen[key] = struct{}{}
+			e.Kind = errorKindTags
+			errs = append(errs, e)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Checking workload tags: %w", errs)
+	}
+	success("Checked the workload tags of %d Terraform targets", targets)
+	return nil
+}
+
+// exactVersionPattern matches an exact Terraform version.
+var exactVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// generatorGoVersion is the key of the version of Go which builds this
+// program in `Project.Versions` of Terraform targets. The `tags` job sets up
+// Go with it rather than with the plan policy checker's version.
+const generatorGoVersion = "generator-go"
+
+// terraformTargetVersions implements `projects.ProjectType.Versions` for
+// Terraform targets. The Terraform version is the target's
+// `required_version` if it names a single version (see `terraformVersion`).
+// A range (e.g., `>= 0.13`) could install different versions for a pull
+// request's plan and the merge's apply, so such targets declare no version
+// and `projects.MissingVersions` warns about them. `.terraform.lock.hcl` only
+// records the versions of providers. The Go versions are those of the tools
+// which the target's jobs run: the plan policy checker and this program.
+func terraformTargetVersions(
+	repo fs.FS,
+	target *projects.Project,
+) (map[string]string, error) {
+	module, err := terraform.LoadModule(repo, target.Path)
+	if err != nil {
+		return nil, terraformErrors(target, err)
+	}
+	versions := map[string]string{}
+	if version := terraformVersion(module); version != "" {
+		versions["terraform"] = version
+	}
+
+	for key, dir := range map[string]string{
+		"go":               planPolicyDir,
+		generatorGoVersion: generatorDir,
+	} {
+		version, err := goVersion(repo, dir)
+		if err != nil {
+			return nil, err
+		}
+		if version != "" {
+			versions[key] = version
+		}
+	}
+	return versions, nil
+}
+
+// terraformVersion returns the module's `required_version` if it names a
+// single version (e.g., `1.1.9` or `= 1.1.9`) and otherwise an empty string.
+func terraformVersion(module *terraform.Module) string {
+	version := strings.TrimSpace(strings.TrimPrefix(
+		strings.TrimSpace(module.RequiredVersion),
+		"=",
+	))
+	if exactVersionPattern.MatchString(version) {
+		return version
+	}
+	return ""
+}
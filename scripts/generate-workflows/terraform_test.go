@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects/projectstest"
+)
+
+func TestTerraformTargetPathsBackends(t *testing.T) {
+	repo := projectstest.Repo{
+		"targets/foo/main.tf":                    "",
+		"targets/foo/environments/dev.tfbackend": "",
+	}
+	target := projects.Project{
+		Path: "targets/foo",
+		Params: map[string][]string{
+			terraformEnvironmentsParam: {"dev"},
+		},
+	}
+	paths, err := terraformTargetPaths(repo.FS(), &target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if wanted := []string{planPolicyDir}; !reflect.DeepEqual(paths, wanted) {
+		t.Fatalf("Wanted paths %v; found %v", wanted, paths)
+	}
+
+	target.Params[terraformEnvironmentsParam] = []string{"dev", "prd"}
+	_, err = terraformTargetPaths(repo.FS(), &target)
+	var e *projects.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Wanted a *projects.Error; found %v", err)
+	}
+	wanted := projects.Error{
+		Kind:    projects.ErrorKindProjectFile,
+		File:    "targets/foo/projects.yaml",
+		Project: "targets/foo",
+		Message: "environment 'prd' has no backend configuration " +
+			"'targets/foo/environments/prd.tfbackend'",
+	}
+	if !reflect.DeepEqual(*e, wanted) {
+		t.Fatalf("Wanted %+v; found %+v", wanted, *e)
+	}
+}
+
+func TestTerraformTargetVersions(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		requiredVersion string
+		version         string
+	}{
+		{name: "exact", requiredVersion: "1.1.9", version: "1.1.9"},
+		{name: "exact operator", requiredVersion: "= 1.1.9", version: "1.1.9"},
+		// Ranges and missing constraints are left to `MissingVersions`.
+		{name: "range", requiredVersion: ">= 0.13"},
+		{name: "none"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := projectstest.Repo{"targets/foo/main.tf": ""}
+			if testCase.requiredVersion != "" {
+				repo["targets/foo/versions.tf"] = "terraform {\n" +
+					"  required_version = \"" + testCase.requiredVersion +
+					"\"\n}\n"
+			}
+			versions, err := terraformTargetVersions(
+				repo.FS(),
+				&projects.Project{Path: "targets/foo"},
+			)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if version := versions["terraform"]; version != testCase.version {
+				t.Fatalf(
+					"Wanted version '%s'; found '%s'",
+					testCase.version,
+					version,
+				)
+			}
+		})
+	}
+}
+
+func TestLoadContractsExportedInEachEnvironment(t *testing.T) {
+	repo := projectstest.Repo{
+		"targets/foo/main.tf": `module "contract_export" {
+  source   = "../../modules/contract/export"
+  workload = { environment = "prd", system = "foo" }
+  data     = { bucket_name = "foo" }
+}
+`,
+	}
+	target := projects.Project{
+		Path: "targets/foo",
+		Params: map[string][]string{
+			terraformEnvironmentsParam: {"dev", "prd"},
+		},
+	}
+	_, errs := loadContracts(repo.FS(), []*projects.Project{&target})
+	if len(errs) != 1 || !strings.Contains(
+		errs[0].Message,
+		"contract 'prd/foo' is exported in each of environments dev, prd",
+	) {
+		t.Fatalf("Wanted an error about the environments; found %v", errs)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+// golangVersions implements `projects.ProjectType.Versions` for Go projects.
+// The Go version is the `go` directive of the project's `go.mod`.
+func golangVersions(
+	repo fs.FS,
+	project *projects.Project,
+) (map[string]string, error) {
+	version, err := goVersion(repo, project.Path)
+	if err != nil || version == "" {
+		return nil, err
+	}
+	return map[string]string{"go": version}, nil
+}
+
+// goVersion returns the `go` directive of the `go.mod` in the repo-relative
+// directory `dir`. It returns an empty string if there's no `go.mod` or it has
+// no `go` directive.
+func goVersion(repo fs.FS, dir string) (string, error) {
+	modFile := path.Join(dir, "go.mod")
+	data, err := fs.ReadFile(repo, modFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Reading '%s': %w", modFile, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 || fields[0] != "go" {
+			continue
+		}
+		if len(fields) != 2 {
+			return "", &projects.Error{
+				Kind:    projects.ErrorKindProjectFile,
+				File:    modFile,
+				Line:    line,
+				Message: "invalid go directive",
+			}
+		}
+		return fields[1], nil
+	}
+	return "", scanner.Err()
+}
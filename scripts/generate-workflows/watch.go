@@ -0,0 +1,376 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/textdiff"
+)
+
+var (
+	pollInterval = flag.Duration(
+		"poll-interval",
+		500*time.Millisecond,
+		"how often the watch subcommand checks its inputs for changes",
+	)
+	debounce = flag.Duration(
+		"debounce",
+		300*time.Millisecond,
+		"how long the watch subcommand waits for its inputs to stop "+
+			"changing before regenerating",
+	)
+)
+
+// generatorDir is the repo-relative path to this program's source directory.
+const generatorDir = "scripts/generate-workflows"
+
+// watch implements the `watch` subcommand. It polls the files which the
+// generator reads from the repository (see `projects.InputFiles`), every
+// `projects.yaml` file (so that new projects are noticed), and the
+// generator's own sources and static assets, and regenerates the workflows
+// whenever they change.
+//
+// Since project types and static assets are compiled into the generator, each
+// regeneration is a `go run` of the generator in a subprocess so that changes
+// to the type definitions take effect. The subprocess receives the same flags
+// as the watcher.
+func watch(env *environment, args []string) error {
+	if len(args) > 0 {
+		return usageErrorf("watch: unexpected arguments")
+	}
+	config, err := env.config()
+	if err != nil {
+		return err
+	}
+	w := watcher{config: config, repoRoot: env.repoRoot}
+	dir := env.outDir
+
+	inputs, err := w.scan()
+	if err != nil {
+		return fmt.Errorf("Scanning watched files: %w", err)
+	}
+	success("Watching %d files", len(inputs))
+	regenerate(w.repoRoot, dir, nil)
+
+	for {
+		time.Sleep(*pollInterval)
+		current := w.scanWithBackoff()
+		if len(changedFiles(inputs, current)) < 1 {
+			continue
+		}
+
+		// Wait for a burst of changes (e.g., an editor writing several files
+		// or a `git checkout`) to settle before regenerating.
+		for {
+			time.Sleep(*debounce)
+			next := w.scanWithBackoff()
+			if len(changedFiles(current, next)) < 1 {
+				break
+			}
+			current = next
+		}
+
+		changed := changedFiles(inputs, current)
+		inputs = current
+		if len(changed) > 0 {
+			regenerate(w.repoRoot, dir, changed)
+		}
+	}
+}
+
+// maxScanDelay caps the delay between retries of a failed scan.
+const maxScanDelay = 30 * time.Second
+
+// watcher finds and stamps the files which `watch` polls.
+type watcher struct {
+	config   *projects.Config
+	repoRoot string
+
+	// inputFiles are the files which project discovery read the last time
+	// it succeeded.
+	inputFiles []string
+}
+
+// scanWithBackoff is like `scan` except that failures are logged and retried
+// until a scan succeeds so that the watcher keeps running. The delay between
+// retries starts from the poll interval and doubles up to `maxScanDelay`.
+func (w *watcher) scanWithBackoff() map[string]fileStamp {
+	delay := *pollInterval
+	for {
+		files, err := w.scan()
+		if err == nil {
+			return files
+		}
+		warning("Scanning watched files (retrying in %s): %v", delay, err)
+		time.Sleep(delay)
+		delay = nextScanDelay(delay)
+	}
+}
+
+// nextScanDelay doubles the delay between retries of a failed scan up to
+// `maxScanDelay`.
+func nextScanDelay(delay time.Duration) time.Duration {
+	if delay *= 2; delay > maxScanDelay {
+		return maxScanDelay
+	}
+	return delay
+}
+
+// scan stamps each watched file with its modification time and size. Project
+// discovery is rerun so that files which it newly reads (e.g., a new `.tf`
+// file in a Terraform target) are watched. If discovery fails (e.g., because
+// a `projects.yaml` file is being edited), the files which it read the last
+// time it succeeded are watched instead; regenerating reports the error.
+func (w *watcher) scan() (map[string]fileStamp, error) {
+	if inputFiles, err := projects.InputFiles(
+		w.config,
+		os.DirFS(w.repoRoot),
+	); err == nil {
+		w.inputFiles = inputFiles
+	}
+
+	files, err := scanGeneratorFiles(w.repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, relPath := range w.inputFiles {
+		info, err := os.Stat(filepath.Join(w.repoRoot, relPath))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		files[relPath] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return files, nil
+}
+
+// regenerate runs the generator and prints a diff of the output directory.
+// Errors are printed rather than returned so that the watcher keeps running.
+func regenerate(repoRoot, dir string, changed []string) {
+	if len(changed) > 0 {
+		fmt.Printf("\nChanged: %s\n", strings.Join(changed, ", "))
+	}
+
+	before, err := snapshotDir(dir)
+	if err != nil {
+		warning("Reading output directory: %v", err)
+	}
+
+	args, err := generateArgs(repoRoot, dir)
+	if err != nil {
+		warning("Building generator arguments: %v", err)
+		return
+	}
+	cmd := exec.Command("go", append([]string{"run", "."}, args...)...)
+	cmd.Dir = filepath.Join(repoRoot, generatorDir)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Stdout.Write(output)
+		color.Red("↪️ ️Regenerating workflows: %v\n", err)
+		return
+	}
+
+	after, err := snapshotDir(dir)
+	if err != nil {
+		warning("Reading output directory: %v", err)
+		return
+	}
+
+	diff := diffSnapshots(before, after)
+	if diff == "" {
+		success("Regenerated workflows (no changes)")
+		return
+	}
+	fmt.Print(diff)
+	success("Regenerated workflows")
+}
+
+// generateArgs returns the arguments for a generator subprocess which renders
+// into `dir` with the same flags as this process, less those which only
+// pertain to `watch`. Paths are made absolute since the subprocess runs in the
+// generator's directory.
+func generateArgs(repoRoot, dir string) ([]string, error) {
+	args := []string{"-repo-root=" + repoRoot, "-out=" + dir}
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "poll-interval", "debounce", "repo-root", "out":
+		case "config":
+			var configPath string
+			if configPath, err = filepath.Abs(f.Value.String()); err == nil {
+				args = append(args, "-config="+configPath)
+			}
+		default:
+			args = append(
+				args,
+				fmt.Sprintf("-%s=%s", f.Name, f.Value.String()),
+			)
+		}
+	})
+	return append(args, "generate"), err
+}
+
+// diffSnapshots returns a concise diff between two snapshots of a directory
+// (see `snapshotDir`). Added and removed files are summarized in a single
+// line rather than diffed in full.
+func diffSnapshots(before, after map[string]string) string {
+	var diff strings.Builder
+	for _, fileName := range sortedKeys(before, after) {
+		a, inBefore := before[fileName]
+		b, inAfter := after[fileName]
+		switch {
+		case !inBefore:
+			fmt.Fprintf(&diff, "added %s\n", fileName)
+		case !inAfter:
+			fmt.Fprintf(&diff, "removed %s\n", fileName)
+		default:
+			diff.WriteString(textdiff.Unified(
+				"a/"+fileName,
+				"b/"+fileName,
+				a,
+				b,
+			))
+		}
+	}
+	return diff.String()
+}
+
+// sortedKeys returns the sorted union of the maps' keys.
+func sortedKeys(maps ...map[string]string) []string {
+	set := map[string]struct{}{}
+	for _, m := range maps {
+		for key := range m {
+			set[key] = struct{}{}
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// scanGeneratorFiles finds the generator's sources and static assets and the
+// `projects.yaml` files in the repository and stamps each with its
+// modification time and size. Hidden directories (including the `.github`
+// output directory) are skipped.
+func scanGeneratorFiles(repoRoot string) (map[string]fileStamp, error) {
+	files := map[string]fileStamp{}
+	err := filepath.WalkDir(repoRoot, func(
+		filePath string,
+		entry fs.DirEntry,
+		err error,
+	) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(repoRoot, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if entry.IsDir() {
+			if relPath != "." && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if relPath == generatorDir+"/testdata" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isWatched(relPath) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files[relPath] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return files, err
+}
+
+// isWatched reports whether the file at the repo-relative path is one of the
+// generator's sources or static assets or is a `projects.yaml` file.
+func isWatched(relPath string) bool {
+	if rest := strings.TrimPrefix(relPath, generatorDir+"/"); rest != relPath {
+		return strings.HasSuffix(rest, ".go") ||
+			rest == "go.mod" ||
+			rest == "go.sum" ||
+			rest == "actions.lock.yaml" ||
+			strings.HasPrefix(rest, "static/")
+	}
+	return filepath.Base(relPath) == projects.KeyFileName
+}
+
+// changedFiles returns the sorted paths of the files which were added,
+// removed, or modified between the `before` and `after` scans.
+func changedFiles(before, after map[string]fileStamp) []string {
+	var changed []string
+	for filePath, stamp := range after {
+		if previous, found := before[filePath]; !found ||
+			!previous.modTime.Equal(stamp.modTime) ||
+			previous.size != stamp.size {
+			changed = append(changed, filePath)
+		}
+	}
+	for filePath := range before {
+		if _, found := after[filePath]; !found {
+			changed = append(changed, filePath)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// snapshotDir reads the contents of every file beneath `dir` keyed by their
+// slash-separated paths relative to `dir`. A missing directory is empty.
+func snapshotDir(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(
+		filePath string,
+		entry fs.DirEntry,
+		err error,
+	) error {
+		if err != nil {
+			if filePath == dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relPath)] = string(data)
+		return nil
+	})
+	return files, err
+}
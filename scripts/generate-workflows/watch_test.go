@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/weberc2/infra/scripts/generate-workflows/pkg/projects"
+)
+
+func TestWatcherScan(t *testing.T) {
+	repoRoot := tempDir(t)
+	writeFiles(t, filepath.Join(repoRoot, "apps/foo"), map[string]string{
+		"projects.yaml": "projects:\n  - type: golang\n",
+		"go.mod":        "module foo\n\ngo 1.16\n",
+		"main.go":       "package main\n",
+	})
+	w := watcher{
+		config:   &projects.Config{ProjectTypes: projectTypes},
+		repoRoot: repoRoot,
+	}
+	wanted := []string{"apps/foo/go.mod", "apps/foo/projects.yaml"}
+	assertScan := func() {
+		t.Helper()
+		files, err := w.scan()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var found []string
+		for relPath := range files {
+			found = append(found, relPath)
+		}
+		sort.Strings(found)
+		if !reflect.DeepEqual(found, wanted) {
+			t.Fatalf("Wanted %v; found %v", wanted, found)
+		}
+	}
+	assertScan()
+
+	// A broken project file doesn't drop the files which discovery read
+	// before.
+	writeFiles(t, filepath.Join(repoRoot, "apps/foo"), map[string]string{
+		"projects.yaml": "projects: [",
+	})
+	assertScan()
+}
+
+func TestWatcherScanWithBackoff(t *testing.T) {
+	defer func(interval time.Duration) { *pollInterval = interval }(
+		*pollInterval,
+	)
+	*pollInterval = time.Millisecond
+
+	// Scans fail until the repository appears.
+	repoRoot := filepath.Join(tempDir(t), "repo")
+	w := watcher{
+		config:   &projects.Config{ProjectTypes: projectTypes},
+		repoRoot: repoRoot,
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		// `t.Fatal` may only be called from the test's goroutine.
+		dir := filepath.Join(repoRoot, "apps/foo")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Errorf("Creating '%s': %v", dir, err)
+			return
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(dir, "projects.yaml"),
+			[]byte("projects:\n  - type: golang\n"),
+			0644,
+		); err != nil {
+			t.Errorf("Writing 'projects.yaml': %v", err)
+		}
+	}()
+	if files := w.scanWithBackoff(); len(files) < 1 {
+		t.Fatal("Wanted the files of the repository once it appeared")
+	}
+}
+
+func TestNextScanDelay(t *testing.T) {
+	if delay := nextScanDelay(time.Second); delay != 2*time.Second {
+		t.Fatalf("Wanted 2s; found %s", delay)
+	}
+	if delay := nextScanDelay(maxScanDelay); delay != maxScanDelay {
+		t.Fatalf("Wanted %s; found %s", maxScanDelay, delay)
+	}
+}
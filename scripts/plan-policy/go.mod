@@ -0,0 +1,3 @@
+module github.com/weberc2/infra/scripts/plan-policy
+
+go 1.16
@@ -0,0 +1,108 @@
+// Command plan-policy checks a Terraform plan against this repository's
+// policies. It reads the JSON representation of a plan (the output of
+// `terraform show -json <planfile>`) from a file or stdin, prints each
+// violation, and exits with status 1 if there are any.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/weberc2/infra/scripts/plan-policy/pkg/policy"
+)
+
+var (
+	target = flag.String(
+		"target",
+		"",
+		"the repo-relative `path` to the Terraform target whose plan is "+
+			"checked (e.g., targets/lambda-support)",
+	)
+	format = flag.String(
+		"format",
+		"text",
+		"the output `format`: 'text', 'json', or 'github' (workflow "+
+			"command annotations)",
+	)
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(
+			flag.CommandLine.Output(),
+			"Usage: plan-policy [FLAGS] [PLAN.json]\n\nFlags:\n",
+		)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 || *target == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var r io.Reader = os.Stdin
+	if flag.NArg() == 1 && flag.Arg(0) != "-" {
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Opening plan: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	plan, err := policy.ReadPlan(r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	config := policy.DefaultConfig
+	config.Target = strings.TrimSuffix(*target, "/")
+	violations := policy.Evaluate(&config, plan)
+
+	switch *format {
+	case "json":
+		if violations == nil {
+			violations = []policy.Violation{}
+		}
+		data, err := json.Marshal(violations)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	case "github":
+		for i := range violations {
+			fmt.Printf(
+				"::error title=plan-policy %s::%s\n",
+				violations[i].Rule,
+				escapeData(violations[i].Address+": "+violations[i].Message),
+			)
+		}
+	default:
+		for i := range violations {
+			fmt.Println(violations[i].Error())
+		}
+	}
+
+	if len(violations) > 0 {
+		fmt.Fprintf(
+			os.Stderr,
+			"%s: %d policy violation(s)\n",
+			config.Target,
+			len(violations),
+		)
+		os.Exit(1)
+	}
+}
+
+// escapeData escapes a GitHub workflow command message.
+func escapeData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
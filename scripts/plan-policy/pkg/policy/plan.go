@@ -0,0 +1,78 @@
+// Package policy evaluates rules against Terraform plans so that dangerous
+// changes are caught before they're applied.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Plan is the subset of the JSON representation of a Terraform plan (the
+// output of `terraform show -json <planfile>`) which the rules inspect.
+type Plan struct {
+	// ResourceChanges are the changes which the plan makes to resources.
+	ResourceChanges []ResourceChange `json:"resource_changes"`
+}
+
+// ResourceChange is a planned change to a resource.
+type ResourceChange struct {
+	// Address is the resource's absolute address (e.g.,
+	// `module.bucket.aws_s3_bucket.bucket`).
+	Address string `json:"address"`
+
+	// Mode is `managed` for resources and `data` for data sources.
+	Mode string `json:"mode"`
+
+	// Type is the resource type (e.g., `aws_s3_bucket`).
+	Type string `json:"type"`
+
+	// Change is the change to the resource.
+	Change Change `json:"change"`
+}
+
+// Change describes the change to a resource.
+type Change struct {
+	// Actions are the actions which the change performs (e.g., `["create"]`
+	// or `["delete", "create"]` for a replacement).
+	Actions []string `json:"actions"`
+
+	// Before is the resource's state before the change; it's nil for a
+	// creation.
+	Before map[string]interface{} `json:"before"`
+
+	// After is the resource's state after the change; it's nil for a
+	// deletion. Attributes whose values aren't known until apply are absent
+	// or null.
+	After map[string]interface{} `json:"after"`
+
+	// AfterUnknown marks the attributes of `After` whose values aren't known
+	// until apply.
+	AfterUnknown map[string]interface{} `json:"after_unknown"`
+}
+
+// Has reports whether the change performs the action.
+func (change *Change) Has(action string) bool {
+	for _, a := range change.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Unknown reports whether the value of the attribute isn't known until
+// apply.
+func (change *Change) Unknown(attribute string) bool {
+	unknown, _ := change.AfterUnknown[attribute].(bool)
+	return unknown
+}
+
+// ReadPlan decodes a JSON plan.
+func ReadPlan(r io.Reader) (*Plan, error) {
+	var plan Plan
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return nil, fmt.Errorf("Decoding plan: %w", err)
+	}
+	return &plan, nil
+}
@@ -0,0 +1,228 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Config parameterizes the rules.
+type Config struct {
+	// Target is the repo-relative path to the Terraform target whose plan is
+	// evaluated (e.g., `targets/lambda-support`).
+	Target string
+
+	// ProtectedTypes are the resource types which may not be destroyed or
+	// replaced.
+	ProtectedTypes []string
+
+	// RequiredTags are the tags which every taggable resource must carry.
+	RequiredTags []string
+
+	// IAMWildcardTargets are the targets which may grant wildcard IAM
+	// actions.
+	IAMWildcardTargets []string
+}
+
+// DefaultConfig is the configuration for this repository. The required tags
+// are those of the `tags` output of `modules/workload`.
+var DefaultConfig = Config{
+	ProtectedTypes:     []string{"aws_s3_bucket", "aws_dynamodb_table"},
+	RequiredTags:       []string{"environment", "management", "system"},
+	IAMWildcardTargets: []string{"targets/bootstrap"},
+}
+
+// Rule is a policy which each resource change must satisfy.
+type Rule struct {
+	// Name identifies the rule.
+	Name string
+
+	// Check returns a message for each way in which the change violates the
+	// rule.
+	Check func(config *Config, change *ResourceChange) []string
+}
+
+// Violation is a resource change which violates a rule.
+type Violation struct {
+	// Rule is the name of the violated rule.
+	Rule string `json:"rule"`
+
+	// Address is the address of the offending resource.
+	Address string `json:"address"`
+
+	// Message describes the violation.
+	Message string `json:"message"`
+}
+
+// Error returns the violation as `<address>: <message> (<rule>)`.
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", v.Address, v.Message, v.Rule)
+}
+
+// Rules are the rules which `Evaluate` checks.
+var Rules = []Rule{
+	{Name: "no-destroy", Check: checkNoDestroy},
+	{Name: "workload-tags", Check: checkWorkloadTags},
+	{Name: "no-iam-wildcards", Check: checkIAMWildcards},
+}
+
+// Evaluate checks every resource change in the plan against the rules and
+// returns the violations ordered by resource address.
+func Evaluate(config *Config, plan *Plan) []Violation {
+	var violations []Violation
+	for i := range plan.ResourceChanges {
+		change := &plan.ResourceChanges[i]
+		if change.Mode != "" && change.Mode != "managed" {
+			continue
+		}
+		for _, rule := range Rules {
+			for _, message := range rule.Check(config, change) {
+				violations = append(violations, Violation{
+					Rule:    rule.Name,
+					Address: change.Address,
+					Message: message,
+				})
+			}
+		}
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Address < violations[j].Address
+	})
+	return violations
+}
+
+// checkNoDestroy forbids destroying (or replacing) resources of the
+// protected types, such as the state bucket and lock table.
+func checkNoDestroy(config *Config, change *ResourceChange) []string {
+	if !change.Change.Has("delete") ||
+		!containsString(config.ProtectedTypes, change.Type) {
+		return nil
+	}
+	verb := "destroys"
+	if change.Change.Has("create") {
+		verb = "replaces"
+	}
+	return []string{fmt.Sprintf("plan %s protected %s", verb, change.Type)}
+}
+
+// checkWorkloadTags requires created and updated resources of the taggable
+// types (see `TaggableResourceTypes`) to carry the required tags (usually via
+// `module.workload.tags`). Null or absent tags carry none. Tags which aren't
+// known until apply are assumed to comply.
+func checkWorkloadTags(config *Config, change *ResourceChange) []string {
+	if !IsTaggable(change.Type) ||
+		(!change.Change.Has("create") && !change.Change.Has("update")) {
+		return nil
+	}
+
+	// `tags_all` includes the provider's `default_tags`, so it's preferred
+	// where the provider supports it.
+	attribute := "tags_all"
+	if _, found := change.Change.After[attribute]; !found &&
+		!change.Change.Unknown(attribute) {
+		attribute = "tags"
+	}
+	if change.Change.Unknown(attribute) {
+		return nil
+	}
+	tags, _ := change.Change.After[attribute].(map[string]interface{})
+
+	var missing []string
+	for _, tag := range config.RequiredTags {
+		if _, found := tags[tag]; !found {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) < 1 {
+		return nil
+	}
+	return []string{fmt.Sprintf(
+		"missing required tags: %s (use module.workload.tags)",
+		strings.Join(missing, ", "),
+	)}
+}
+
+// administratorAccess is the ARN of the AWS-managed policy which grants every
+// action.
+const administratorAccess = "arn:aws:iam::aws:policy/AdministratorAccess"
+
+// checkIAMWildcards forbids IAM policies which allow every action (`*`) or
+// every action of a service (e.g., `s3:*`), and attachments of the
+// `AdministratorAccess` policy, except in the allowlisted targets. Policies
+// which aren't known until apply are assumed to comply.
+func checkIAMWildcards(config *Config, change *ResourceChange) []string {
+	if containsString(config.IAMWildcardTargets, config.Target) ||
+		(!change.Change.Has("create") && !change.Change.Has("update")) {
+		return nil
+	}
+
+	if strings.HasPrefix(change.Type, "aws_iam_") &&
+		strings.HasSuffix(change.Type, "_policy_attachment") {
+		if arn, _ := change.Change.After["policy_arn"].(string); arn ==
+			administratorAccess {
+			return []string{"attaches AdministratorAccess"}
+		}
+		return nil
+	}
+
+	document, ok := change.Change.After["policy"].(string)
+	if !ok || !strings.HasPrefix(change.Type, "aws_iam_") {
+		return nil
+	}
+	var policy struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return []string{fmt.Sprintf("parsing policy: %v", err)}
+	}
+
+	var messages []string
+	for _, statement := range oneOrMany(policy.Statement) {
+		var s struct {
+			Effect string
+			Action json.RawMessage
+		}
+		if err := json.Unmarshal(statement, &s); err != nil {
+			return []string{fmt.Sprintf("parsing policy statement: %v", err)}
+		}
+		if s.Effect != "Allow" {
+			continue
+		}
+		for _, raw := range oneOrMany(s.Action) {
+			var action string
+			if err := json.Unmarshal(raw, &action); err != nil {
+				continue
+			}
+			if action == "*" || strings.HasSuffix(action, ":*") {
+				messages = append(
+					messages,
+					fmt.Sprintf("policy allows wildcard action '%s'", action),
+				)
+			}
+		}
+	}
+	return messages
+}
+
+// oneOrMany returns the elements of a JSON array or, if the value isn't an
+// array, the value itself. IAM policy elements may be either.
+func oneOrMany(raw json.RawMessage) []json.RawMessage {
+	if len(raw) < 1 {
+		return nil
+	}
+	var many []json.RawMessage
+	if err := json.Unmarshal(raw, &many); err == nil {
+		return many
+	}
+	return []json.RawMessage{raw}
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
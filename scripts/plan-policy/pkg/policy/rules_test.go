@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	const tags = `{"environment": "prd", "management": "terraform", ` +
+		`"system": "foo"}`
+	// The policy is a JSON document encoded as a JSON string.
+	const policy = `"{\"Statement\": {\"Effect\": \"Allow\", ` +
+		`\"Action\": [\"s3:GetObject\", \"s3:*\"]}}"`
+	for _, testCase := range []struct {
+		name       string
+		target     string
+		change     string
+		violations []string
+	}{
+		{
+			name: "tagged",
+			change: `"type": "aws_s3_bucket"` +
+				`, "change": {"actions": ["create"]` +
+				`, "after": {"tags": ` + tags + `}}`,
+		},
+		{
+			name: "missing tags",
+			change: `"type": "aws_s3_bucket"` +
+				`, "change": {"actions": ["update"]` +
+				`, "after": {"tags": {"system": "foo"}}}`,
+			violations: []string{"workload-tags"},
+		},
+		{
+			name: "null tags",
+			change: `"type": "aws_s3_bucket_object"` +
+				`, "change": {"actions": ["create"]` +
+				`, "after": {"tags": null}}`,
+			violations: []string{"workload-tags"},
+		},
+		{
+			name: "null tags of an untaggable type",
+			change: `"type": "aws_iam_user_policy_attachment"` +
+				`, "change": {"actions": ["create"]` +
+				`, "after": {"tags": null}}`,
+		},
+		{
+			name: "unknown tags",
+			change: `"type": "aws_s3_bucket"` +
+				`, "change": {"actions": ["create"]` +
+				`, "after": {}` +
+				`, "after_unknown": {"tags_all": true}}`,
+		},
+		{
+			name: "tags_all includes default tags",
+			change: `"type": "aws_s3_bucket"` +
+				`, "change": {"actions": ["create"]` +
+				`, "after": {"tags": null, "tags_all": ` + tags + `}}`,
+		},
+		{
+			name: "destroys a protected type",
+			change: `"type": "aws_dynamodb_table"` +
+				`, "change": {"actions": ["delete"]}`,
+			violations: []string{"no-destroy"},
+		},
+		{
+			name: "destroys an unprotected type",
+			change: `"type": "aws_iam_user_policy_attachment"` +
+				`, "change": {"actions": ["delete"]}`,
+		},
+		{
+			name:   "wildcard action",
+			target: "targets/foo",
+			change: `"type": "aws_iam_policy"` +
+				`, "change": {"actions": ["create"]` +
+				`, "after": {"tags": ` + tags + `, "policy": ` + policy + `}}`,
+			violations: []string{"no-iam-wildcards"},
+		},
+		{
+			name:   "administrator access",
+			target: "targets/foo",
+			change: `"type": "aws_iam_user_policy_attachment"` +
+				`, "change": {"actions": ["create"]` +
+				`, "after": {"policy_arn": "` + administratorAccess + `"}}`,
+			violations: []string{"no-iam-wildcards"},
+		},
+		{
+			name:   "administrator access in an allowlisted target",
+			target: "targets/bootstrap",
+			change: `"type": "aws_iam_user_policy_attachment"` +
+				`, "change": {"actions": ["create"]` +
+				`, "after": {"policy_arn": "` + administratorAccess + `"}}`,
+		},
+		{
+			name: "data source",
+			change: `"mode": "data", "type": "aws_s3_bucket"` +
+				`, "change": {"actions": ["read"]` +
+				`, "after": {}}`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			plan, err := ReadPlan(strings.NewReader(
+				`{"resource_changes": [{"address": "x.y", ` +
+					testCase.change + `}]}`,
+			))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			config := DefaultConfig
+			config.Target = testCase.target
+			var rules []string
+			for _, violation := range Evaluate(&config, plan) {
+				rules = append(rules, violation.Rule)
+			}
+			if !reflect.DeepEqual(rules, testCase.violations) {
+				t.Fatalf(
+					"Wanted violations %v; found %v",
+					testCase.violations,
+					rules,
+				)
+			}
+		})
+	}
+}
+
+func TestTaggableResourceTypesSorted(t *testing.T) {
+	for i := 1; i < len(TaggableResourceTypes); i++ {
+		if TaggableResourceTypes[i-1] >= TaggableResourceTypes[i] {
+			t.Fatalf(
+				"'%s' is out of order (IsTaggable searches the list)",
+				TaggableResourceTypes[i],
+			)
+		}
+	}
+}
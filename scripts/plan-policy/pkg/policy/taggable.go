@@ -0,0 +1,43 @@
+package policy
+
+import "sort"
+
+// TaggableResourceTypes are the sorted AWS resource types which must carry
+// the workload tags. Terraform's provider schemas aren't available without
+// initializing the providers, so this lists the types which this repository
+// uses or is likely to use. The `workload-tags` rule and the static checker
+// of `generate-workflows tags` both use it.
+var TaggableResourceTypes = []string{
+	"aws_acm_certificate",
+	"aws_apigatewayv2_api",
+	"aws_apigatewayv2_stage",
+	"aws_cloudfront_distribution",
+	"aws_cloudwatch_log_group",
+	"aws_cognito_user_pool",
+	"aws_dynamodb_table",
+	"aws_ecr_repository",
+	"aws_iam_policy",
+	"aws_iam_role",
+	"aws_iam_user",
+	"aws_instance",
+	"aws_kms_key",
+	"aws_lambda_function",
+	"aws_route53_zone",
+	"aws_s3_bucket",
+	"aws_s3_bucket_object",
+	"aws_secretsmanager_secret",
+	"aws_security_group",
+	"aws_sns_topic",
+	"aws_sqs_queue",
+	"aws_ssm_parameter",
+	"aws_subnet",
+	"aws_vpc",
+}
+
+// IsTaggable reports whether the resource type is in
+// `TaggableResourceTypes`.
+func IsTaggable(resourceType string) bool {
+	i := sort.SearchStrings(TaggableResourceTypes, resourceType)
+	return i < len(TaggableResourceTypes) &&
+		TaggableResourceTypes[i] == resourceType
+}
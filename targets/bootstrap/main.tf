@@ -2,6 +2,12 @@ locals {
   account_alias = "weberc2"
 }
 
+module "workload" {
+  source      = "../../modules/workload"
+  environment = "prd"
+  system      = "bootstrap"
+}
+
 resource "aws_s3_bucket" "state" {
   bucket = "weberc2-terraform-state"
 
@@ -12,6 +18,8 @@ resource "aws_s3_bucket" "state" {
       }
     }
   }
+
+  tags = module.workload.tags
 }
 
 resource "aws_dynamodb_table" "lock" {
@@ -28,11 +36,14 @@ resource "aws_dynamodb_table" "lock" {
     name = "LockID"
     type = "S"
   }
+
+  tags = module.workload.tags
 }
 
 resource "aws_iam_user" "terraform" {
   name = "terraform"
   path = "/system/"
+  tags = module.workload.tags
 }
 
 resource "aws_iam_user_policy_attachment" "admin" {